@@ -0,0 +1,172 @@
+package suite
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-faceit-candidate/restuser"
+)
+
+// serverSentEvent is an event received from the changes stream
+type serverSentEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// userChange is the data of the changes stream events
+type userChange struct {
+	Type        string         `json:"type"`
+	UserID      string         `json:"user_id"`
+	UserVersion int64          `json:"user_version"`
+	User        *restuser.User `json:"user"`
+}
+
+func (s *acceptanceSuite) TestUserChanges() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.Run("streams the changes of the country", func() {
+		events := s.streamChanges(ctx, "?country="+someOtherCountry, "")
+
+		_, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someOtherCountry,
+		})
+		s.Require().NoError(err)
+
+		event := s.nextEvent(ctx, events)
+		s.Equal("user.created", event.Event)
+		s.NotEmpty(event.ID)
+
+		var change userChange
+		s.Require().NoError(json.Unmarshal([]byte(event.Data), &change))
+		s.Equal(created.ID, change.UserID)
+		s.Equal(int64(1), change.UserVersion)
+		s.Require().NotNil(change.User)
+		s.Equal(*created, *change.User)
+
+		s.Run("resumes after the last event", func() {
+			var patched restuser.User
+			s.patchJSON(ctx, "/v1/users/"+created.ID, map[string]interface{}{"name": someOtherName}, http.StatusOK, &patched)
+
+			resumed := s.streamChanges(ctx, "?country="+someOtherCountry, event.ID)
+			event := s.nextEvent(ctx, resumed)
+			s.Equal("user.updated", event.Event)
+			s.Require().NoError(json.Unmarshal([]byte(event.Data), &change))
+			s.Equal(created.ID, change.UserID)
+			s.Equal(someOtherName, change.User.Name)
+		})
+	})
+
+	s.Run("streams the deletions and restorations", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someOtherCountry,
+		})
+		s.Require().NoError(err)
+
+		events := s.streamChanges(ctx, "?country="+someOtherCountry, "")
+		s.Require().NoError(s.client.DeleteUser(ctx, created.ID))
+
+		event := s.nextEvent(ctx, events)
+		s.Equal("user.deleted", event.Event)
+		var change userChange
+		s.Require().NoError(json.Unmarshal([]byte(event.Data), &change))
+		s.Equal(created.ID, change.UserID)
+		s.Equal(int64(2), change.UserVersion)
+		s.Nil(change.User)
+
+		s.postJSON(ctx, "/v1/users/"+created.ID+"/restore", nil, http.StatusOK, nil)
+
+		event = s.nextEvent(ctx, events)
+		s.Equal("user.created", event.Event)
+		change = userChange{}
+		s.Require().NoError(json.Unmarshal([]byte(event.Data), &change))
+		s.Equal(created.ID, change.UserID)
+		s.Equal(int64(3), change.UserVersion)
+		s.Require().NotNil(change.User)
+		s.Equal(someOtherCountry, change.User.Country)
+	})
+
+	s.Run("unknown last event is reset", func() {
+		events := s.streamChanges(ctx, "", "1")
+		s.Equal("reset", s.nextEvent(ctx, events).Event)
+	})
+}
+
+// streamChanges connects to the changes stream sending the Last-Event-ID provided, the events are sent to the channel
+func (s *acceptanceSuite) streamChanges(ctx context.Context, query, lastEventID string) <-chan serverSentEvent {
+	s.T().Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.RESTClient.URL+"/v1/users/changes"+query, nil)
+	s.Require().NoError(err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan serverSentEvent)
+	go func() {
+		defer resp.Body.Close()
+		var event serverSentEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.Event != "" {
+					select {
+					case events <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+				event = serverSentEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+func (s *acceptanceSuite) nextEvent(ctx context.Context, events <-chan serverSentEvent) serverSentEvent {
+	s.T().Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-ctx.Done():
+		s.FailNow("Timeout waiting for the changes stream event")
+		return serverSentEvent{}
+	}
+}
@@ -34,20 +34,40 @@ func (s *acceptanceSuite) TestCreateUser() {
 		s.Equal(someEmail, created.Email)
 		s.Equal(someCountry, created.Country)
 		s.Empty(created.Password)
-		s.NotEmpty(created.PasswordSalt)
-		s.Equal(s.saltedPasswordHash(somePassword, created.PasswordSalt), created.PasswordHash)
+		s.Empty(created.PasswordHash)
+		s.Empty(created.PasswordSalt)
+		s.assertPasswordMatches(ctx, created.ID, somePassword)
 
 		s.True(rfc3339ToTime(s.T(), created.CreatedAt).After(testStart))
 		s.True(rfc3339ToTime(s.T(), created.UpdatedAt).After(testStart))
 
 		select {
-		case id := <-s.userCreatedMessages:
-			s.Equal(created.ID, id)
+		case event := <-s.userCreatedMessages:
+			s.Equal(1, event.Version)
+			s.NotEmpty(event.ID)
+			s.Equal("user.created", event.Type)
+			s.Equal(created.ID, event.UserID)
+			s.Equal(int64(1), event.UserVersion)
+			s.Require().NotNil(event.User)
+			s.Equal(*created, *event.User)
 		case <-ctx.Done():
 			s.Fail("Timeout waiting for the created NSQ message")
 		}
 	})
 
+	s.Run("email already in use", func() {
+		_, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someOtherFirstName,
+			LastName:  someOtherLastName,
+			Name:      someOtherName,
+			Email:     strings.ToUpper(someEmail),
+			Password:  someOtherPassword,
+			Country:   someOtherCountry,
+		})
+		s.Require().Error(err)
+		s.assertIsRestClientError(err, http.StatusConflict)
+	})
+
 	s.Run("invalid params", func() {
 		for testName, user := range map[string]*restuser.User{
 			"id provided": {
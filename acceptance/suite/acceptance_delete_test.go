@@ -3,11 +3,18 @@ package suite
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/a-faceit-candidate/restuser"
 )
 
+// deletedUser is the user listed when the deleted ones are included
+type deletedUser struct {
+	restuser.User
+	DeletedAt string `json:"deleted_at"`
+}
+
 func (s *acceptanceSuite) TestDeleteUser() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
@@ -32,14 +39,99 @@ func (s *acceptanceSuite) TestDeleteUser() {
 
 		s.assertIsRestClientError(err, http.StatusNotFound)
 
+		// deleted message is sent once the user is purged, the retention period is short in the acceptance config
 		select {
-		case id := <-s.userDeletedMessages:
-			s.Equal(created.ID, id)
+		case event := <-s.userDeletedMessages:
+			s.Equal(created.ID, event.UserID)
+			// deleting and purging increased the version
+			s.Equal(int64(3), event.UserVersion)
+			s.Nil(event.User)
 		case <-ctx.Done():
 			s.Fail("Timeout waiting for the deleted NSQ message")
 		}
 	})
 
+	s.Run("versioned", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		var patched restuser.User
+		s.patchJSON(ctx, "/v1/users/"+created.ID, map[string]interface{}{"name": someOtherName}, http.StatusOK, &patched)
+
+		// user was modified after it was created
+		s.doJSON(ctx, http.MethodDelete, "/v1/users/"+created.ID+"?updated_at="+url.QueryEscape(created.UpdatedAt), nil, http.StatusConflict, nil)
+		s.doJSON(ctx, http.MethodDelete, "/v1/users/"+created.ID+"?updated_at="+url.QueryEscape(patched.UpdatedAt), nil, http.StatusNoContent, nil)
+
+		_, err = s.client.GetUser(ctx, created.ID)
+		s.Require().Error(err)
+		s.assertIsRestClientError(err, http.StatusNotFound)
+	})
+
+	s.Run("versioned not found", func() {
+		s.doJSON(ctx, http.MethodDelete, "/v1/users/not-found?updated_at="+url.QueryEscape(time.Now().Format(time.RFC3339Nano)), nil, http.StatusNotFound, nil)
+	})
+
+	s.Run("restore", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someOtherCountry,
+		})
+		s.Require().NoError(err)
+
+		err = s.client.DeleteUser(ctx, created.ID)
+		s.Require().NoError(err)
+
+		var listed []deletedUser
+		s.getJSON(ctx, "/v1/users/?include_deleted=true&country="+someOtherCountry, http.StatusOK, &listed)
+		s.Require().Len(listed, 1)
+		s.Equal(created.ID, listed[0].ID)
+		s.NotEmpty(listed[0].DeletedAt)
+
+		s.getJSON(ctx, "/v1/users/?country="+someOtherCountry, http.StatusOK, &listed)
+		s.Empty(listed)
+
+		// deleted users keep their email until they're purged
+		var errResp restuser.ErrorResponse
+		s.postJSON(ctx, "/v1/users/", &restuser.User{
+			FirstName: someOtherFirstName,
+			LastName:  someOtherLastName,
+			Name:      someOtherName,
+			Email:     created.Email,
+			Password:  someOtherPassword,
+			Country:   someOtherCountry,
+		}, http.StatusConflict, &errResp)
+		s.Contains(errResp.Message, "deleted user")
+
+		var restored restuser.User
+		s.postJSON(ctx, "/v1/users/"+created.ID+"/restore", nil, http.StatusOK, &restored)
+		s.Equal(created.ID, restored.ID)
+		s.Equal(created.Email, restored.Email)
+		s.True(rfc3339ToTime(s.T(), restored.UpdatedAt).After(rfc3339ToTime(s.T(), created.UpdatedAt)), "Restored UpdatedAt should be after created UpdatedAt")
+
+		got, err := s.client.GetUser(ctx, created.ID)
+		s.Require().NoError(err)
+		s.Equal(restored, *got)
+		s.assertPasswordMatches(ctx, created.ID, somePassword)
+
+		// it's not deleted anymore
+		s.postJSON(ctx, "/v1/users/"+created.ID+"/restore", nil, http.StatusNotFound, nil)
+	})
+
+	s.Run("restore not found", func() {
+		s.postJSON(ctx, "/v1/users/not-found/restore", nil, http.StatusNotFound, nil)
+	})
+
 	s.Run("not found", func() {
 		err := s.client.DeleteUser(ctx, "not-found")
 		s.Require().Error(err)
@@ -0,0 +1,73 @@
+package suite
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a-faceit-candidate/restuser"
+)
+
+func (s *acceptanceSuite) TestETag() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	createUser := func() (restuser.User, string) {
+		var created restuser.User
+		header := s.doRequest(ctx, http.MethodPost, "/v1/users/", "application/json", nil, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		}, http.StatusCreated, &created)
+		s.Require().NotEmpty(header.Get("ETag"))
+		return created, header.Get("ETag")
+	}
+
+	s.Run("get", func() {
+		created, tag := createUser()
+
+		header := s.doRequest(ctx, http.MethodGet, "/v1/users/"+created.ID, "", nil, nil, http.StatusOK, nil)
+		s.Equal(tag, header.Get("ETag"))
+
+		s.doRequest(ctx, http.MethodGet, "/v1/users/"+created.ID, "", http.Header{"If-None-Match": {tag}}, nil, http.StatusNotModified, nil)
+		s.doRequest(ctx, http.MethodGet, "/v1/users/"+created.ID, "", http.Header{"If-None-Match": {`"other", W/` + tag}}, nil, http.StatusNotModified, nil)
+		s.doRequest(ctx, http.MethodGet, "/v1/users/"+created.ID, "", http.Header{"If-None-Match": {`"other"`}}, nil, http.StatusOK, nil)
+	})
+
+	s.Run("put", func() {
+		created, tag := createUser()
+		created.UpdatedAt = ""
+		created.Name = someOtherName
+
+		var updated restuser.User
+		header := s.doRequest(ctx, http.MethodPut, "/v1/users/"+created.ID, "application/json", http.Header{"If-Match": {tag}}, created, http.StatusOK, &updated)
+		s.Equal(someOtherName, updated.Name)
+		s.NotEqual(tag, header.Get("ETag"))
+
+		// the tag is outdated now
+		s.doRequest(ctx, http.MethodPut, "/v1/users/"+created.ID, "application/json", http.Header{"If-Match": {tag}}, created, http.StatusPreconditionFailed, nil)
+		s.doRequest(ctx, http.MethodPut, "/v1/users/"+created.ID, "application/json", http.Header{"If-Match": {"W/" + header.Get("ETag")}}, created, http.StatusPreconditionFailed, nil)
+	})
+
+	s.Run("patch", func() {
+		created, tag := createUser()
+
+		header := s.doRequest(ctx, http.MethodPatch, "/v1/users/"+created.ID, "application/merge-patch+json", http.Header{"If-Match": {tag}}, map[string]interface{}{"name": someOtherName}, http.StatusOK, nil)
+		s.NotEqual(tag, header.Get("ETag"))
+
+		s.doRequest(ctx, http.MethodPatch, "/v1/users/"+created.ID, "application/merge-patch+json", http.Header{"If-Match": {tag}}, map[string]interface{}{"name": someName}, http.StatusPreconditionFailed, nil)
+		s.doRequest(ctx, http.MethodPatch, "/v1/users/"+created.ID, "application/merge-patch+json", http.Header{"If-Match": {`"unknown"`}}, map[string]interface{}{"name": someName}, http.StatusPreconditionFailed, nil)
+	})
+
+	s.Run("delete", func() {
+		created, tag := createUser()
+
+		header := s.doRequest(ctx, http.MethodPatch, "/v1/users/"+created.ID, "application/merge-patch+json", nil, map[string]interface{}{"name": someOtherName}, http.StatusOK, nil)
+
+		s.doRequest(ctx, http.MethodDelete, "/v1/users/"+created.ID, "", http.Header{"If-Match": {tag}}, nil, http.StatusPreconditionFailed, nil)
+		s.doRequest(ctx, http.MethodDelete, "/v1/users/"+created.ID, "", http.Header{"If-Match": {header.Get("ETag")}}, nil, http.StatusNoContent, nil)
+	})
+}
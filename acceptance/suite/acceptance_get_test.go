@@ -3,11 +3,19 @@ package suite
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/a-faceit-candidate/restuser"
 )
 
+type userCredentials struct {
+	ID           string `json:"id"`
+	PasswordHash string `json:"password_hash"`
+	PasswordSalt string `json:"password_salt"`
+}
+
 func (s *acceptanceSuite) TestGetUser() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
@@ -34,8 +42,8 @@ func (s *acceptanceSuite) TestGetUser() {
 		s.Equal(someName, got.Name)
 		s.Equal(someEmail, got.Email)
 		s.Equal(someCountry, got.Country)
-		s.Equal(created.PasswordHash, got.PasswordHash)
-		s.Equal(created.PasswordSalt, got.PasswordSalt)
+		s.Empty(got.PasswordHash)
+		s.Empty(got.PasswordSalt)
 	})
 
 	s.Run("not found", func() {
@@ -43,4 +51,50 @@ func (s *acceptanceSuite) TestGetUser() {
 		s.Require().Error(err)
 		s.assertIsRestClientError(err, http.StatusNotFound)
 	})
+
+	s.Run("by email", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someOtherFirstName,
+			LastName:  someOtherLastName,
+			Name:      someOtherName,
+			Email:     someOtherEmail,
+			Password:  someOtherPassword,
+			Country:   someOtherCountry,
+		})
+		s.Require().NoError(err)
+
+		var found []restuser.User
+		s.getJSON(ctx, "/v1/users/?email="+url.QueryEscape(strings.ToUpper(someOtherEmail)), http.StatusOK, &found)
+		s.Require().Len(found, 1)
+		s.Equal(created.ID, found[0].ID)
+		s.Equal(someOtherEmail, found[0].Email)
+	})
+
+	s.Run("by email not found", func() {
+		var found []restuser.User
+		s.getJSON(ctx, "/v1/users/?email=nobody%40faceit.com", http.StatusOK, &found)
+		s.Empty(found)
+	})
+
+	s.Run("credentials", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		var credentials userCredentials
+		s.getJSON(ctx, "/v1/users/"+created.ID+"/credentials", http.StatusOK, &credentials)
+		s.Equal(created.ID, credentials.ID)
+		s.True(strings.HasPrefix(credentials.PasswordHash, "$argon2id$"), "Hash should be argon2id, got %s", credentials.PasswordHash)
+		s.Empty(credentials.PasswordSalt)
+	})
+
+	s.Run("credentials not found", func() {
+		s.getJSON(ctx, "/v1/users/not-found/credentials", http.StatusNotFound, nil)
+	})
 }
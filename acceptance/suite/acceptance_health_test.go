@@ -0,0 +1,41 @@
+package suite
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// healthReport is the response of /health/ready
+type healthReport struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status   string  `json:"status"`
+		Critical bool    `json:"critical"`
+		Latency  float64 `json:"latency_ms"`
+	} `json:"checks"`
+}
+
+func (s *acceptanceSuite) TestHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.Run("live", func() {
+		var report healthReport
+		s.getJSON(ctx, "/health/live", http.StatusOK, &report)
+		s.Equal("ok", report.Status)
+	})
+
+	s.Run("ready", func() {
+		var report healthReport
+		s.getJSON(ctx, "/health/ready", http.StatusOK, &report)
+		s.Equal("ok", report.Status)
+		for _, name := range []string{"mysql", "nsq", "event_backlog"} {
+			s.Require().Contains(report.Checks, name)
+			s.Equal("ok", report.Checks[name].Status, name)
+		}
+		s.True(report.Checks["mysql"].Critical)
+		s.False(report.Checks["nsq"].Critical)
+		s.False(report.Checks["event_backlog"].Critical)
+	})
+}
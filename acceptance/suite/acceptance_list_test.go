@@ -2,6 +2,8 @@ package suite
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/a-faceit-candidate/restuser"
@@ -45,4 +47,34 @@ func (s *acceptanceSuite) TestListUsers() {
 		s.Require().Len(all, 1)
 		s.Equal(someOtherName, all[0].Name)
 	})
+
+	s.Run("paginated", func() {
+		var page usersPage
+		s.getJSON(ctx, "/v1/users/?limit=1", http.StatusOK, &page)
+		s.Require().Len(page.Users, 1)
+		s.Equal(someName, page.Users[0].Name)
+		s.Require().NotEmpty(page.NextCursor)
+
+		s.getJSON(ctx, "/v1/users/?limit=1&cursor="+url.QueryEscape(page.NextCursor), http.StatusOK, &page)
+		s.Require().Len(page.Users, 1)
+		s.Equal(someOtherName, page.Users[0].Name)
+		s.Empty(page.NextCursor)
+	})
+
+	s.Run("paginated by country", func() {
+		var page usersPage
+		s.getJSON(ctx, "/v1/users/?limit=10&country="+someOtherCountry, http.StatusOK, &page)
+		s.Require().Len(page.Users, 1)
+		s.Equal(someOtherName, page.Users[0].Name)
+		s.Empty(page.NextCursor)
+	})
+
+	s.Run("invalid cursor", func() {
+		s.getJSON(ctx, "/v1/users/?cursor=not-a-cursor!", http.StatusBadRequest, nil)
+	})
+}
+
+type usersPage struct {
+	Users      []restuser.User `json:"users"`
+	NextCursor string          `json:"next_cursor"`
 }
@@ -0,0 +1,91 @@
+package suite
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-faceit-candidate/restuser"
+)
+
+type passwordVerification struct {
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password"`
+}
+
+type passwordVerificationResult struct {
+	Match bool `json:"match"`
+}
+
+func (s *acceptanceSuite) TestVerifyPassword() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	created, err := s.client.CreateUser(ctx, &restuser.User{
+		FirstName: someFirstName,
+		LastName:  someLastName,
+		Name:      someName,
+		Email:     someEmail,
+		Password:  somePassword,
+		Country:   someCountry,
+	})
+	s.Require().NoError(err)
+
+	s.Run("by id", func() {
+		var result passwordVerificationResult
+		s.postJSON(ctx, "/v1/users/"+created.ID+"/password/verify", passwordVerification{Password: somePassword}, http.StatusOK, &result)
+		s.True(result.Match)
+
+		s.postJSON(ctx, "/v1/users/"+created.ID+"/password/verify", passwordVerification{Password: someOtherPassword}, http.StatusOK, &result)
+		s.False(result.Match)
+	})
+
+	s.Run("by email", func() {
+		var result passwordVerificationResult
+		s.postJSON(ctx, "/v1/user-password/verify", passwordVerification{Email: strings.ToUpper(someEmail), Password: somePassword}, http.StatusOK, &result)
+		s.True(result.Match)
+
+		s.postJSON(ctx, "/v1/user-password/verify", passwordVerification{Email: someEmail, Password: someOtherPassword}, http.StatusOK, &result)
+		s.False(result.Match)
+	})
+
+	s.Run("not found", func() {
+		var result passwordVerificationResult
+		s.postJSON(ctx, "/v1/users/not-found/password/verify", passwordVerification{Password: somePassword}, http.StatusNotFound, nil)
+		s.postJSON(ctx, "/v1/user-password/verify", passwordVerification{Email: someOtherEmail, Password: somePassword}, http.StatusOK, &result)
+		s.False(result.Match, "unknown emails should look like a wrong password")
+	})
+
+	s.Run("no password", func() {
+		s.postJSON(ctx, "/v1/users/"+created.ID+"/password/verify", passwordVerification{}, http.StatusBadRequest, nil)
+	})
+
+	s.Run("legacy hash is upgraded", func() {
+		const (
+			legacyID   = "legacy-user"
+			legacySalt = "1234567890abcdef1234567890abcdef"
+		)
+		now := time.Now().UTC()
+		_, err := s.db.ExecContext(ctx,
+			"INSERT INTO user (id, created_at, updated_at, first_name, last_name, name, email, normalized_email, password_hash, password_salt, country) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			legacyID, now, now, someOtherFirstName, someOtherLastName, someOtherName, someOtherEmail, someOtherEmail,
+			s.saltedPasswordHash(someOtherPassword, legacySalt), legacySalt, someOtherCountry,
+		)
+		s.Require().NoError(err)
+
+		var result passwordVerificationResult
+		s.postJSON(ctx, "/v1/users/"+legacyID+"/password/verify", passwordVerification{Password: someOtherPassword}, http.StatusOK, &result)
+		s.True(result.Match)
+
+		var hash, salt string
+		err = s.db.QueryRowContext(ctx, "SELECT password_hash, password_salt FROM user WHERE id = ?", legacyID).Scan(&hash, &salt)
+		s.Require().NoError(err)
+		s.True(strings.HasPrefix(hash, "$argon2id$"), "Hash should have been upgraded to argon2id, got %s", hash)
+		s.Empty(salt)
+
+		// and the upgraded hash still works
+		s.postJSON(ctx, "/v1/users/"+legacyID+"/password/verify", passwordVerification{Password: someOtherPassword}, http.StatusOK, &result)
+		s.True(result.Match)
+	})
+}
@@ -0,0 +1,127 @@
+package suite
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a-faceit-candidate/restuser"
+)
+
+func (s *acceptanceSuite) TestPatchUser() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.Run("happy case", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     someEmail,
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		var patched restuser.User
+		s.patchJSON(ctx, "/v1/users/"+created.ID, map[string]interface{}{"country": someOtherCountry}, http.StatusOK, &patched)
+		s.Equal(created.ID, patched.ID)
+		s.Equal(created.CreatedAt, patched.CreatedAt)
+		s.True(rfc3339ToTime(s.T(), patched.UpdatedAt).After(rfc3339ToTime(s.T(), created.UpdatedAt)), "Patched UpdatedAt should be after created UpdatedAt")
+		s.Equal(someFirstName, patched.FirstName)
+		s.Equal(someLastName, patched.LastName)
+		s.Equal(someName, patched.Name)
+		s.Equal(someEmail, patched.Email)
+		s.Equal(someOtherCountry, patched.Country)
+		s.Empty(patched.PasswordHash)
+
+		got, err := s.client.GetUser(ctx, created.ID)
+		s.Require().NoError(err)
+		s.Equal(patched, *got)
+		s.assertPasswordMatches(ctx, created.ID, somePassword)
+
+		select {
+		case event := <-s.userUpdatedMessages:
+			s.Equal(created.ID, event.UserID)
+			s.Equal([]string{"country"}, event.ChangedFields)
+		case <-ctx.Done():
+			s.Fail("Timeout waiting for the updated NSQ message")
+		}
+	})
+
+	s.Run("password", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		s.patchJSON(ctx, "/v1/users/"+created.ID, map[string]interface{}{"password": someOtherPassword}, http.StatusOK, nil)
+		s.assertPasswordMatches(ctx, created.ID, someOtherPassword)
+	})
+
+	s.Run("conflict", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		s.patchJSON(ctx, "/v1/users/"+created.ID, map[string]interface{}{"updated_at": created.UpdatedAt, "name": someOtherName}, http.StatusOK, nil)
+		// second patch fails because the user was modified after created.UpdatedAt
+		s.patchJSON(ctx, "/v1/users/"+created.ID, map[string]interface{}{"updated_at": created.UpdatedAt, "name": someName}, http.StatusConflict, nil)
+	})
+
+	s.Run("invalid params", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		for testName, patch := range map[string]map[string]interface{}{
+			"removed name":              {"name": nil},
+			"empty first name":          {"first_name": ""},
+			"non two character country": {"country": "zzz"},
+			"too short password":        {"password": "1234567"},
+			"id provided":               {"id": "injected"},
+			"password hash provided":    {"password_hash": "injected"},
+			"non string name":           {"name": 42},
+			"malformed updated_at":      {"updated_at": "yesterday"},
+		} {
+			s.Run(testName, func() {
+				s.patchJSON(ctx, "/v1/users/"+created.ID, patch, http.StatusBadRequest, nil)
+			})
+		}
+	})
+
+	s.Run("not merge patch", func() {
+		created, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		s.doJSON(ctx, http.MethodPatch, "/v1/users/"+created.ID, map[string]interface{}{"country": someOtherCountry}, http.StatusUnsupportedMediaType, nil)
+	})
+
+	s.Run("not found", func() {
+		s.patchJSON(ctx, "/v1/users/not-found", map[string]interface{}{"country": someOtherCountry}, http.StatusNotFound, nil)
+	})
+}
@@ -45,7 +45,7 @@ type acceptanceSuite struct {
 	db     *sql.DB
 
 	userCreatedConsumer, userUpdatedConsumer, userDeletedConsumer *nsq.Consumer
-	userCreatedMessages, userUpdatedMessages, userDeletedMessages chan string
+	userCreatedMessages, userUpdatedMessages, userDeletedMessages chan userEvent
 }
 
 func (s *acceptanceSuite) SetupSuite() {
@@ -107,8 +107,10 @@ func (s *acceptanceSuite) TearDownTest() {
 	s.userDeletedConsumer.Stop()
 
 	s.testAceptadora.StopAll(ctx)
-	_, err := s.db.ExecContext(ctx, "TRUNCATE user")
-	s.Require().NoError(err)
+	for _, table := range []string{"user", "webhook", "webhook_delivery"} {
+		_, err := s.db.ExecContext(ctx, "TRUNCATE "+table)
+		s.Require().NoError(err)
+	}
 }
 
 func (s *acceptanceSuite) TearDownSuite() {
@@ -122,20 +124,33 @@ func TestAcceptanceSuite(t *testing.T) {
 	suite.Run(t, new(acceptanceSuite))
 }
 
-// nsqConsumerToChannel creates a nsq.Consumer that handles JSON string messages from the given topic
+// userEvent is the envelope of the events published by the userservice
+type userEvent struct {
+	Version       int            `json:"version"`
+	ID            string         `json:"id"`
+	Type          string         `json:"type"`
+	Time          string         `json:"time"`
+	UserID        string         `json:"user_id"`
+	UserVersion   int64          `json:"user_version"`
+	User          *restuser.User `json:"user"`
+	Previous      *restuser.User `json:"previous"`
+	ChangedFields []string       `json:"changed_fields"`
+}
+
+// nsqConsumerToChannel creates a nsq.Consumer that handles JSON event envelope messages from the given topic
 // and sends them through the provided channel
-func (s acceptanceSuite) nsqConsumerToChannel(topic string) (*nsq.Consumer, chan string) {
-	ch := make(chan string, 1000) // a channel with enough buffer to keep our messages
+func (s acceptanceSuite) nsqConsumerToChannel(topic string) (*nsq.Consumer, chan userEvent) {
+	ch := make(chan userEvent, 1000) // a channel with enough buffer to keep our messages
 	consumer, err := nsq.NewConsumer(topic, "acceptance-test", nsq.NewConfig())
 	s.Require().NoError(err)
 
 	consumer.AddHandler(nsq.HandlerFunc(func(msg *nsq.Message) error {
-		var str string
-		if err := json.Unmarshal(msg.Body, &str); err != nil {
-			s.T().Logf("Failed to unmarshal msg from topic %s as string: %s", topic, err)
+		var event userEvent
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			s.T().Logf("Failed to unmarshal msg from topic %s as event: %s", topic, err)
 			return err
 		}
-		ch <- str
+		ch <- event
 		return nil
 	}))
 
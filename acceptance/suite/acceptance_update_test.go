@@ -46,8 +46,8 @@ func (s *acceptanceSuite) TestUpdateUser() {
 		s.Equal(someOtherEmail, updated.Email)
 		s.Equal(someOtherCountry, updated.Country)
 		s.Empty(updated.Password)
-		s.NotEmpty(updated.PasswordSalt)
-		s.Equal(s.saltedPasswordHash(someOtherPassword, updated.PasswordSalt), updated.PasswordHash)
+		s.Empty(updated.PasswordHash)
+		s.Empty(updated.PasswordSalt)
 
 		got, err := s.client.GetUser(ctx, created.ID)
 		s.Require().NoError(err)
@@ -60,12 +60,20 @@ func (s *acceptanceSuite) TestUpdateUser() {
 		s.Equal(someOtherEmail, got.Email)
 		s.Equal(someOtherCountry, got.Country)
 		s.Empty(got.Password)
-		s.NotEmpty(got.PasswordSalt)
-		s.Equal(s.saltedPasswordHash(someOtherPassword, got.PasswordSalt), got.PasswordHash)
+		s.Empty(got.PasswordHash)
+		s.assertPasswordMatches(ctx, created.ID, someOtherPassword)
 
 		select {
-		case id := <-s.userUpdatedMessages:
-			s.Equal(created.ID, id)
+		case event := <-s.userUpdatedMessages:
+			s.Equal("user.updated", event.Type)
+			s.Equal(created.ID, event.UserID)
+			s.Equal(int64(2), event.UserVersion)
+			s.Require().NotNil(event.User)
+			s.Equal(*updated, *event.User)
+			s.Require().NotNil(event.Previous)
+			s.Equal(someFirstName, event.Previous.FirstName)
+			s.Equal(someEmail, event.Previous.Email)
+			s.ElementsMatch([]string{"first_name", "last_name", "name", "email", "country", "password"}, event.ChangedFields)
 		case <-ctx.Done():
 			s.Fail("Timeout waiting for the updated NSQ message")
 		}
@@ -77,26 +85,18 @@ func (s *acceptanceSuite) TestUpdateUser() {
 			FirstName: someFirstName,
 			LastName:  someLastName,
 			Name:      someName,
-			Email:     someEmail,
+			Email:     uniqueEmail(),
 			Password:  somePassword,
 			Country:   someCountry,
 		})
 		s.Require().NoError(err)
 
-		hash := created.PasswordHash
-		salt := created.PasswordSalt
-
 		created.FirstName = someOtherFirstName
-		created.PasswordHash = ""
-		created.PasswordSalt = ""
 
 		_, err = s.client.UpdateUser(ctx, created)
 		s.Require().NoError(err)
 
-		got, err := s.client.GetUser(ctx, created.ID)
-		s.Require().NoError(err)
-		s.Equal(hash, got.PasswordHash)
-		s.Equal(salt, got.PasswordSalt)
+		s.assertPasswordMatches(ctx, created.ID, somePassword)
 	})
 
 	s.Run("conflict", func() {
@@ -104,7 +104,7 @@ func (s *acceptanceSuite) TestUpdateUser() {
 			FirstName: someFirstName,
 			LastName:  someLastName,
 			Name:      someName,
-			Email:     someEmail,
+			Email:     uniqueEmail(),
 			Password:  somePassword,
 			Country:   someCountry,
 		})
@@ -124,6 +124,36 @@ func (s *acceptanceSuite) TestUpdateUser() {
 		s.assertIsRestClientError(err, http.StatusConflict)
 	})
 
+	s.Run("email already in use", func() {
+		existing, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		toUpdate, err := s.client.CreateUser(ctx, &restuser.User{
+			FirstName: someFirstName,
+			LastName:  someLastName,
+			Name:      someName,
+			Email:     uniqueEmail(),
+			Password:  somePassword,
+			Country:   someCountry,
+		})
+		s.Require().NoError(err)
+
+		toUpdate.Email = strings.ToUpper(existing.Email)
+		toUpdate.PasswordHash = ""
+		toUpdate.PasswordSalt = ""
+
+		_, err = s.client.UpdateUser(ctx, toUpdate)
+		s.Require().Error(err)
+		s.assertIsRestClientError(err, http.StatusConflict)
+	})
+
 	s.Run("invalid params", func() {
 		for testName, user := range map[string]*restuser.User{
 			"empty first name": {
@@ -194,7 +224,7 @@ func (s *acceptanceSuite) TestUpdateUser() {
 					FirstName: someFirstName,
 					LastName:  someLastName,
 					Name:      someName,
-					Email:     someEmail,
+					Email:     uniqueEmail(),
 					Password:  somePassword,
 					Country:   someCountry,
 				})
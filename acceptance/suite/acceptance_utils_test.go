@@ -1,9 +1,16 @@
 package suite
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -29,6 +36,23 @@ const (
 	someOtherPassword  = "security"
 )
 
+var emailSequence uint64
+
+// uniqueEmail provides a different email on each call, useful when creating several users in same test
+// as the emails should be unique across users.
+func uniqueEmail() string {
+	return fmt.Sprintf("john+%d@faceit.com", atomic.AddUint64(&emailSequence, 1))
+}
+
+// assertPasswordMatches checks the password of the user using the password verification endpoint
+func (s *acceptanceSuite) assertPasswordMatches(ctx context.Context, id, password string) {
+	s.T().Helper()
+	var result passwordVerificationResult
+	s.postJSON(ctx, "/v1/users/"+id+"/password/verify", passwordVerification{Password: password}, http.StatusOK, &result)
+	s.True(result.Match, "Password should match")
+}
+
+// saltedPasswordHash calculates the password hashes generated by previous versions of the service
 func (s *acceptanceSuite) saltedPasswordHash(password, salt string) string {
 	hash := sha256.Sum256([]byte(password + salt))
 	return hex.EncodeToString(hash[:])
@@ -43,6 +67,61 @@ func (s *acceptanceSuite) assertIsRestClientError(err error, expectedStatusCode
 	}
 }
 
+// getJSON performs a GET request to the userservice on the given path, asserting the status code received.
+// If dst is provided, response body will be json-unmarshaled into it.
+// We use this for the endpoints that aren't supported by the restuser client yet.
+func (s *acceptanceSuite) getJSON(ctx context.Context, path string, expectedStatusCode int, dst interface{}) {
+	s.T().Helper()
+	s.doJSON(ctx, http.MethodGet, path, nil, expectedStatusCode, dst)
+}
+
+// postJSON works like getJSON, but performs a POST request sending the json-marshaled body provided.
+func (s *acceptanceSuite) postJSON(ctx context.Context, path string, body interface{}, expectedStatusCode int, dst interface{}) {
+	s.T().Helper()
+	s.doJSON(ctx, http.MethodPost, path, body, expectedStatusCode, dst)
+}
+
+// patchJSON works like postJSON, but performs a PATCH request sending the body as a JSON merge patch.
+func (s *acceptanceSuite) patchJSON(ctx context.Context, path string, body interface{}, expectedStatusCode int, dst interface{}) {
+	s.T().Helper()
+	s.doRequest(ctx, http.MethodPatch, path, "application/merge-patch+json", nil, body, expectedStatusCode, dst)
+}
+
+func (s *acceptanceSuite) doJSON(ctx context.Context, method, path string, body interface{}, expectedStatusCode int, dst interface{}) {
+	s.T().Helper()
+	s.doRequest(ctx, method, path, "application/json", nil, body, expectedStatusCode, dst)
+}
+
+// doRequest performs the request sending the provided headers, and returns the headers of the response.
+func (s *acceptanceSuite) doRequest(ctx context.Context, method, path, contentType string, header http.Header, body interface{}, expectedStatusCode int, dst interface{}) http.Header {
+	s.T().Helper()
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		s.Require().NoError(err)
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.RESTClient.URL+path, reqBody)
+	s.Require().NoError(err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Require().Equal(expectedStatusCode, resp.StatusCode)
+	if dst != nil {
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(dst))
+	}
+	return resp.Header
+}
+
 func rfc3339ToTime(t *testing.T, rfc3339 string) time.Time {
 	parsed, err := time.Parse(time.RFC3339, rfc3339)
 	require.NoError(t, err)
@@ -0,0 +1,75 @@
+package suite
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// webhook is the webhook returned by the /v1/webhooks endpoints
+type webhook struct {
+	ID                  string   `json:"id"`
+	URL                 string   `json:"url"`
+	Secret              string   `json:"secret"`
+	Events              []string `json:"events"`
+	ConsecutiveFailures int      `json:"consecutive_failures"`
+	DisabledAt          string   `json:"disabled_at"`
+}
+
+func (s *acceptanceSuite) TestWebhooks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.Run("register, list and delete", func() {
+		var created webhook
+		s.postJSON(ctx, "/v1/webhooks/", map[string]interface{}{
+			// nothing listens there, deliveries just fail
+			"url":    "http://localhost:1/hook",
+			"events": []string{"user.created"},
+		}, http.StatusCreated, &created)
+		s.NotEmpty(created.ID)
+		s.NotEmpty(created.Secret, "Secret should be generated")
+		s.Equal([]string{"user.created"}, created.Events)
+
+		var got webhook
+		s.getJSON(ctx, "/v1/webhooks/"+created.ID, http.StatusOK, &got)
+		s.Equal(created.ID, got.ID)
+		s.Equal(created.URL, got.URL)
+		s.Empty(got.Secret, "Secret should only be returned on creation")
+
+		var listed []webhook
+		s.getJSON(ctx, "/v1/webhooks/", http.StatusOK, &listed)
+		s.Require().Len(listed, 1)
+		s.Equal(created.ID, listed[0].ID)
+
+		var deliveries []map[string]interface{}
+		s.getJSON(ctx, "/v1/webhooks/"+created.ID+"/deliveries", http.StatusOK, &deliveries)
+
+		var enabled webhook
+		s.postJSON(ctx, "/v1/webhooks/"+created.ID+"/enable", nil, http.StatusOK, &enabled)
+		s.Empty(enabled.DisabledAt)
+		s.Zero(enabled.ConsecutiveFailures)
+
+		s.doJSON(ctx, http.MethodDelete, "/v1/webhooks/"+created.ID, nil, http.StatusNoContent, nil)
+		s.getJSON(ctx, "/v1/webhooks/"+created.ID, http.StatusNotFound, nil)
+		s.getJSON(ctx, "/v1/webhooks/"+created.ID+"/deliveries", http.StatusNotFound, nil)
+	})
+
+	s.Run("invalid params", func() {
+		for testName, body := range map[string]map[string]interface{}{
+			"no url":        {"events": []string{"user.created"}},
+			"relative url":  {"url": "/hook"},
+			"unknown event": {"url": "http://localhost:1/hook", "events": []string{"user.exploded"}},
+		} {
+			s.Run(testName, func() {
+				s.postJSON(ctx, "/v1/webhooks/", body, http.StatusBadRequest, nil)
+			})
+		}
+	})
+
+	s.Run("not found", func() {
+		s.getJSON(ctx, "/v1/webhooks/not-found", http.StatusNotFound, nil)
+		s.doJSON(ctx, http.MethodDelete, "/v1/webhooks/not-found", nil, http.StatusNotFound, nil)
+		s.postJSON(ctx, "/v1/webhooks/not-found/enable", nil, http.StatusNotFound, nil)
+	})
+}
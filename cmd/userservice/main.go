@@ -1,24 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/a-faceit-candidate/userservice/internal/api"
+	"github.com/a-faceit-candidate/userservice/internal/command"
 	"github.com/a-faceit-candidate/userservice/internal/event"
+	"github.com/a-faceit-candidate/userservice/internal/health"
 	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/metrics"
 	"github.com/a-faceit-candidate/userservice/internal/persistence"
 	"github.com/a-faceit-candidate/userservice/internal/service"
+	"github.com/a-faceit-candidate/userservice/internal/tracing"
 	"github.com/colega/envconfig"
 	"github.com/gin-gonic/gin"
 	"github.com/nsqio/go-nsq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
-	ginprometheus "github.com/zsais/go-gin-prometheus"
 )
 
 type config struct {
@@ -26,39 +34,184 @@ type config struct {
 	Host string
 	// Port configures the port where the app listens
 	Port string `default:"8080"`
+	// AdminPort configures the port where the app serves the prometheus metrics, on the same interface as Host
+	AdminPort string `default:"9090"`
 	// MysqlDSN is formed as "user:password@network(address)/database?options
 	// We could split it into separate env vars and build the DSN in the service, but this is enough for the challenge
 	MysqlDSN string
 
 	// NsqdAddr is the TCP address of the nsqd to use
 	NsqdAddr string `default:"nsqd:4150"`
+	// EventFormat is the payload format of the published events, "id" is only kept for compatibility with old consumers
+	EventFormat event.Format `default:"envelope"`
+	// EventSource is the source of the events published with "cloudevents" format
+	EventSource string `default:"userservice"`
+
+	// PasswordHashing configures the algorithm used to hash the passwords
+	PasswordHashing service.PasswordHasherConfig
+
+	// Purger configures the permanent deletion of the deleted users
+	Purger service.PurgerConfig
+
+	// EventSpool configures the disk spool for the events that can't be published to NSQ, it's disabled by default.
+	// The spool file should be in a persistent volume, so the spooled events survive restarts.
+	EventSpool event.SpoolConfig
+
+	// OutboxRelay configures the publishing of the events stored in the outbox
+	OutboxRelay service.OutboxRelayConfig
+
+	// AsyncObservers notifies the repository observers in background, so slow observers don't delay the requests
+	AsyncObservers bool `default:"true"`
+	// AsyncObserver configures the queue of each observer when AsyncObservers is enabled
+	AsyncObserver persistence.AsyncObserverConfig
+
+	// Changes configures the feed of the user changes streamed through /v1/users/changes
+	Changes service.ChangeFeedConfig
+
+	// Webhooks configures the delivery of the events to the HTTP endpoints registered through /v1/webhooks,
+	// it's disabled by default
+	Webhooks event.WebhookConfig
+
+	// Commands configures the consumption of the commands sent through NSQ, it's disabled by default
+	Commands command.Config
+
+	// Health configures the checks of the dependencies reported by /health/ready
+	Health health.Config
+
+	// Tracing configures the export of the OpenTelemetry spans, it's disabled by default
+	Tracing tracing.Config
+
+	// Shutdown configures the graceful shutdown of the service once SIGTERM or SIGINT is received
+	Shutdown shutdownConfig
+
+	// UnpaginatedListEnabled lists all the users in a plain array when /v1/users is requested without pagination params,
+	// as previous versions of this service did. This should only be enabled until all the clients paginate the list.
+	UnpaginatedListEnabled bool
+
+	// CredentialsExportEnabled exposes the password hashes of the users through /v1/users/:id/credentials
+	// This should only be enabled while migrating the users to another system.
+	CredentialsExportEnabled bool
+}
+
+// shutdownConfig configures the phases of the graceful shutdown
+type shutdownConfig struct {
+	// ReadinessDelay is the time /status and /health/ready fail before the HTTP server stops, so the load balancers stop sending requests
+	ReadinessDelay time.Duration `default:"5s"`
+	// GracePeriod is the maximum time waiting for the in-flight requests and commands to finish
+	GracePeriod time.Duration `default:"20s"`
+	// FlushTimeout is the maximum time publishing the pending events before stopping the NSQ producer
+	FlushTimeout time.Duration `default:"10s"`
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		return
+	}
+
 	var cfg config
 	envconfig.MustProcess("APP", &cfg)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	successOrPanicf("Can't setup tracing: %s", err)
+
 	producer, err := nsq.NewProducer(cfg.NsqdAddr, nsq.NewConfig())
 	successOrPanicf("Can't instantiate NSQ producer: %s", err)
 
+	var publisher service.Publisher = producer
+	var spool *event.SpooledProducer
+	if cfg.EventSpool.Path != "" {
+		spool, err = event.NewSpooledProducer(producer, cfg.EventSpool)
+		successOrPanicf("Can't instantiate event spool: %s", err)
+		publisher = spool
+	}
+
 	db, err := sql.Open("mysql", cfg.MysqlDSN)
 	successOrPanicf("Can't dial MySQL conn: %s", err)
+	prometheus.MustRegister(persistence.NewDBStatsCollector(db))
+
+	encoder, err := event.NewEncoder(cfg.EventFormat, cfg.EventSource)
+	successOrPanicf("Can't instantiate event encoder: %s", err)
+
+	// events are stored in the outbox by the repository, and published to NSQ by the outbox relay,
+	// observers are only needed for other kind of notifications.
+	changes := service.NewChangeFeed(cfg.Changes)
+	observed := map[string]persistence.CRUDObserver{"changes": changes}
+
+	webhookRepo := persistence.NewMysqlWebhookRepository(db)
+	var webhooks *event.WebhookDispatcher
+	if cfg.Webhooks.Enabled {
+		webhooks = event.NewWebhookDispatcher(webhookRepo, encoder, cfg.Webhooks)
+		observed["webhooks"] = webhooks
+	}
+
+	observers, closeObservers := newObservers(cfg, observed)
 
 	userRepo := persistence.NewObservedRepository(
-		persistence.NewMysqlRepository(db),
-		event.NewNSQPublisher(producer),
+		persistence.NewInstrumentedRepository(persistence.NewMysqlRepository(db, encoder)),
+		observers...,
 	)
 
-	svc := service.New(userRepo)
-	userResource := api.NewUsersResource(svc)
+	hasher, err := service.NewPasswordHasher(cfg.PasswordHashing)
+	successOrPanicf("Can't instantiate password hasher: %s", err)
+
+	svc := service.New(userRepo, hasher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	runInBackground := func(run func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(ctx)
+		}()
+	}
+
+	outbox := persistence.NewMysqlOutbox(db)
+	relay := service.NewOutboxRelay(outbox, publisher, cfg.OutboxRelay)
+	runInBackground(service.NewPurger(userRepo, cfg.Purger).Run)
+	runInBackground(relay.Run)
+	if spool != nil {
+		runInBackground(spool.Run)
+	}
+	if webhooks != nil {
+		runInBackground(webhooks.Run)
+	}
+
+	var consumer *nsq.Consumer
+	if cfg.Commands.Enabled {
+		consumer = newCommandsConsumer(cfg, svc, publisher)
+	}
+
+	userResource := api.NewUsersResource(svc, changes, cfg.UnpaginatedListEnabled)
+
+	healthRegistry := newHealthRegistry(cfg, db, producer, outbox, spool)
 
 	g := gin.New()
+	g.Use(tracing.Middleware)
 	g.Use(log.AddLogContextBaggage)
-	g.GET("/status", func(c *gin.Context) { c.Status(http.StatusOK) })
+	g.Use(metrics.NewHTTP(prometheus.DefaultRegisterer).Middleware)
+	g.GET("/status", func(c *gin.Context) {
+		status := gin.H{}
+		if spool != nil {
+			status["event_spool_size"] = spool.Size()
+		}
+		if healthRegistry.ShuttingDown() {
+			status["status"] = "shutting down"
+			c.JSON(http.StatusServiceUnavailable, status)
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+	api.NewHealthResource(healthRegistry).AddRoutes(g)
 	userResource.AddRoutes(g.Group("/v1"))
-
-	// TODO: prevent high cardinality metrics by removing :id params from labels
-	ginprometheus.NewPrometheus("gin").Use(g)
+	if cfg.CredentialsExportEnabled {
+		logrus.Warningf("Credentials export is enabled")
+		userResource.AddCredentialsExportRoutes(g.Group("/v1"))
+	}
+	if webhooks != nil {
+		api.NewWebhooksResource(service.NewWebhookService(webhookRepo, webhooks, cfg.Webhooks.AllowPrivateURLs)).AddRoutes(g.Group("/v1"))
+	}
 
 	addr := net.JoinHostPort(cfg.Host, cfg.Port)
 	ln, err := net.Listen("tcp", addr)
@@ -66,14 +219,200 @@ func main() {
 	logrus.Infof("Listening on %s", addr)
 
 	srv := &http.Server{Handler: g}
+	// changes streams never finish by themselves, so they're closed once the shutdown starts
+	srv.RegisterOnShutdown(changes.Close)
 	go func() {
 		if err := srv.Serve(ln); err != http.ErrServerClosed {
 			panic(err)
 		}
 	}()
-	defer srv.Close()
+
+	adminSrv := newAdminServer(cfg)
 
 	waitForSignal()
+
+	// each phase stops what the following ones depend on: requests and commands write users and events,
+	// background jobs and observers write events too, which are published before closing the producer and the DB.
+	logrus.Infof("Failing readiness for %s", cfg.Shutdown.ReadinessDelay)
+	healthRegistry.Shutdown()
+	time.Sleep(cfg.Shutdown.ReadinessDelay)
+
+	logrus.Infof("Shutting down HTTP server")
+	shutdownServer(srv, cfg.Shutdown.GracePeriod)
+
+	if consumer != nil {
+		logrus.Infof("Stopping commands consumer")
+		stopConsumer(consumer, cfg.Shutdown.GracePeriod)
+	}
+
+	logrus.Infof("Stopping background jobs")
+	cancel()
+	background.Wait()
+
+	logrus.Infof("Draining observers")
+	closeObservers()
+	if webhooks != nil {
+		closeWebhookDispatcher(webhooks, cfg.Webhooks.DrainTimeout)
+	}
+
+	logrus.Infof("Flushing events and stopping NSQ producer")
+	flushEvents(relay, spool, cfg.Shutdown.FlushTimeout)
+	producer.Stop()
+
+	logrus.Infof("Closing MySQL connections")
+	if err := db.Close(); err != nil {
+		logrus.Errorf("Can't close MySQL connections: %s", err)
+	}
+
+	logrus.Infof("Flushing spans")
+	flushSpans(shutdownTracing, cfg.Shutdown.FlushTimeout)
+
+	// metrics are served until the end, so the shutdown can be observed too
+	if err := adminSrv.Close(); err != nil {
+		logrus.Errorf("Can't close admin server: %s", err)
+	}
+
+	logrus.Infof("Shutdown completed")
+}
+
+// newHealthRegistry registers the checks of the dependencies: the service isn't ready without MySQL or NSQ,
+// while a growing backlog of events only degrades it, as they're eventually published.
+func newHealthRegistry(cfg config, db *sql.DB, producer *nsq.Producer, outbox persistence.Outbox, spool *event.SpooledProducer) *health.Registry {
+	registry := health.NewRegistry(cfg.Health)
+	registry.Register("mysql", true, health.Ping(db))
+	// events are stored in the outbox while nsqd is unreachable, so the service can still serve requests
+	registry.Register("nsq", false, health.PingNSQ(producer))
+	registry.Register("event_backlog", false, health.Backlog(func(ctx context.Context) (int, error) {
+		pending, err := outbox.CountPending(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if spool != nil {
+			pending += spool.Size()
+		}
+		return pending, nil
+	}, cfg.Health.MaxEventBacklog))
+	return registry
+}
+
+// newAdminServer serves the prometheus metrics on its own listener, so they're not exposed with the API
+func newAdminServer(cfg config) *http.Server {
+	addr := net.JoinHostPort(cfg.Host, cfg.AdminPort)
+	ln, err := net.Listen("tcp", addr)
+	successOrPanicf("Can't listen admin: %s", err)
+	logrus.Infof("Serving admin on %s", addr)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(ln); err != http.ErrServerClosed {
+			panic(err)
+		}
+	}()
+	return srv
+}
+
+// shutdownServer waits until the in-flight requests are finished, up to the timeout provided,
+// then the remaining connections are closed.
+func shutdownServer(srv *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.Errorf("Can't shutdown HTTP server gracefully, closing it: %s", err)
+		_ = srv.Close()
+	}
+}
+
+// stopConsumer waits until the in-flight commands are finished, up to the timeout provided
+func stopConsumer(consumer *nsq.Consumer, timeout time.Duration) {
+	consumer.Stop()
+	select {
+	case <-consumer.StopChan:
+	case <-time.After(timeout):
+		logrus.Errorf("Commands consumer didn't stop after %s", timeout)
+	}
+}
+
+// flushEvents publishes the events stored in the outbox since the last relay, and the spooled ones, before stopping.
+// Events that can't be published are kept in the outbox or the spool for the next run.
+func flushEvents(relay *service.OutboxRelay, spool *event.SpooledProducer, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if relayed, err := relay.Relay(ctx); err != nil {
+		logrus.Errorf("Can't relay outbox events, %d were relayed: %s", relayed, err)
+	}
+
+	if spool == nil {
+		return
+	}
+	if _, err := spool.Flush(); err != nil {
+		logrus.Warningf("Can't publish spooled events, %d left: %s", spool.Size(), err)
+	}
+	if err := spool.Close(); err != nil {
+		logrus.Errorf("Can't close event spool: %s", err)
+	}
+}
+
+// flushSpans exports the pending spans, including the ones of the shutdown, and stops the exporter
+func flushSpans(shutdownTracing func(context.Context) error, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		logrus.Errorf("Can't flush spans: %s", err)
+	}
+}
+
+// newObservers wraps the observers with AsyncObservers if configured,
+// the func returned waits until their queues are drained, and should be called once the service is stopped.
+func newObservers(cfg config, observers map[string]persistence.CRUDObserver) ([]persistence.CRUDObserver, func()) {
+	var wrapped []persistence.CRUDObserver
+	var async []*persistence.AsyncObserver
+	for name, ob := range observers {
+		if !cfg.AsyncObservers {
+			wrapped = append(wrapped, ob)
+			continue
+		}
+		a, err := persistence.NewAsyncObserver(name, ob, cfg.AsyncObserver)
+		successOrPanicf("Can't instantiate async observer: %s", err)
+		async = append(async, a)
+		wrapped = append(wrapped, a)
+	}
+
+	return wrapped, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.AsyncObserver.DrainTimeout)
+		defer cancel()
+		for _, a := range async {
+			if err := a.Close(ctx); err != nil {
+				logrus.Errorf("Can't drain observer: %s", err)
+			}
+		}
+	}
+}
+
+// closeWebhookDispatcher waits until the queued webhook deliveries are finished, up to the timeout provided
+func closeWebhookDispatcher(webhooks *event.WebhookDispatcher, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := webhooks.Close(ctx); err != nil {
+		logrus.Errorf("Can't drain webhooks: %s", err)
+	}
+}
+
+// newCommandsConsumer subscribes to the commands topic, replies are published through the publisher provided
+func newCommandsConsumer(cfg config, svc service.Service, publisher service.Publisher) *nsq.Consumer {
+	nsqCfg := nsq.NewConfig()
+	nsqCfg.MaxAttempts = cfg.Commands.MaxAttempts
+	nsqCfg.MaxInFlight = cfg.Commands.Concurrency
+
+	consumer, err := nsq.NewConsumer(cfg.Commands.Topic, cfg.Commands.Channel, nsqCfg)
+	successOrPanicf("Can't instantiate NSQ commands consumer: %s", err)
+	consumer.AddConcurrentHandlers(command.NewHandler(svc, publisher, cfg.Commands), cfg.Commands.Concurrency)
+
+	err = consumer.ConnectToNSQD(cfg.NsqdAddr)
+	successOrPanicf("Can't connect NSQ commands consumer: %s", err)
+	logrus.Infof("Consuming commands from %s", cfg.Commands.Topic)
+	return consumer
 }
 
 func waitForSignal() {
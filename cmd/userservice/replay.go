@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/event"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+	"github.com/a-faceit-candidate/userservice/internal/service"
+	"github.com/colega/envconfig"
+	"github.com/nsqio/go-nsq"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	replayEventCreated  = "created"
+	replayEventSnapshot = "snapshot"
+)
+
+// replay publishes the existing users, it's run as `userservice replay [flags]`.
+// It uses the same environment config as the service.
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	country := flags.String("country", "", "replay only the users from this country")
+	updatedSince := flags.String("updated-since", "", "replay only the users updated since this RFC3339 time")
+	eventType := flags.String("event", replayEventSnapshot, "event published for each user: "+replayEventCreated+" or "+replayEventSnapshot)
+	rate := flags.Int("rate", 100, "maximum users published per second, 0 means no limit")
+	batchSize := flags.Int("batch-size", 100, "users retrieved from mysql at once")
+	progressFile := flags.String("progress-file", "", "file where the last replayed user ID is stored, the replay is resumed from it if it exists")
+	_ = flags.Parse(args)
+
+	replayCfg := service.ReplayerConfig{
+		Country:   *country,
+		BatchSize: *batchSize,
+		Rate:      *rate,
+	}
+	if *updatedSince != "" {
+		t, err := time.Parse(time.RFC3339, *updatedSince)
+		successOrPanicf("Invalid updated-since: %s", err)
+		replayCfg.UpdatedSince = t
+	}
+
+	var cfg config
+	envconfig.MustProcess("APP", &cfg)
+
+	producer, err := nsq.NewProducer(cfg.NsqdAddr, nsq.NewConfig())
+	successOrPanicf("Can't instantiate NSQ producer: %s", err)
+	defer producer.Stop()
+
+	db, err := sql.Open("mysql", cfg.MysqlDSN)
+	successOrPanicf("Can't dial MySQL conn: %s", err)
+	defer db.Close()
+
+	publisher, err := event.NewNSQPublisher(producer, cfg.EventFormat, cfg.EventSource)
+	successOrPanicf("Can't instantiate NSQ publisher: %s", err)
+
+	var publish func(context.Context, *model.User) error
+	switch *eventType {
+	case replayEventCreated:
+		publish = publisher.OnCreate
+	case replayEventSnapshot:
+		publish = publisher.PublishSnapshot
+	default:
+		successOrPanicf("Invalid event: %s", fmt.Errorf("unknown event %q", *eventType))
+	}
+
+	afterID, err := readReplayProgress(*progressFile)
+	successOrPanicf("Can't read progress: %s", err)
+	if afterID != "" {
+		logrus.Infof("Resuming replay after user %s", afterID)
+	}
+
+	// the replayer only reads from the repository, so no events are stored in the outbox
+	replayer := service.NewReplayer(persistence.NewMysqlRepository(db, nil), publish, replayCfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		waitForSignal()
+		cancel()
+	}()
+
+	published, err := replayer.Replay(ctx, afterID, func(lastID string) error {
+		return writeReplayProgress(*progressFile, lastID)
+	})
+	logrus.Infof("Replayed %d users", published)
+	successOrPanicf("Can't replay users: %s", err)
+}
+
+// readReplayProgress returns an empty ID if there's no progress file
+func readReplayProgress(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeReplayProgress replaces the progress file atomically, so it's never left half-written
+func writeReplayProgress(path, lastID string) error {
+	if path == "" {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("can't create progress file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(lastID + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("can't write progress file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("can't write progress file: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/a-faceit-candidate/restuser"
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// changesPath is the path of the changes stream under /users
+const changesPath = "changes"
+
+// changesHeartbeatInterval is the time between the comments sent to keep the stream alive through the proxies
+const changesHeartbeatInterval = 15 * time.Second
+
+// changesResetEvent is sent when the changes after Last-Event-ID can't be provided,
+// so the client should retrieve the users again before applying the following changes.
+const changesResetEvent = "reset"
+
+// getChanges streams the user changes as server-sent events, filtering them by the country query param if provided.
+// Clients reconnecting with the Last-Event-ID header receive the changes they've missed meanwhile.
+func (res *UsersResource) getChanges(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var lastID int64
+	if lastIDHeader := c.GetHeader("Last-Event-ID"); lastIDHeader != "" {
+		var err error
+		lastID, err = strconv.ParseInt(lastIDHeader, 10, 64)
+		if err != nil {
+			log.For(ctx).Infof("Received a malformed Last-Event-ID: %s", err)
+			c.JSON(http.StatusBadRequest, errorResponse("Can't parse Last-Event-ID: %s", err))
+			return
+		}
+	}
+	country := c.Query("country")
+
+	missed, complete, sub := res.changes.Subscribe(lastID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if !complete {
+		log.For(ctx).Infof("Changes after %d aren't available anymore", lastID)
+		fmt.Fprintf(c.Writer, "event: %s\ndata: {}\n\n", changesResetEvent)
+	}
+	for _, change := range missed {
+		writeChange(c, change, country)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(changesHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case change, ok := <-sub.C:
+			if !ok {
+				// subscriber was too slow, or the service is stopping, client will reconnect with the Last-Event-ID
+				log.For(ctx).Infof("Changes subscription was closed, closing the stream")
+				return
+			}
+			writeChange(c, change, country)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// writeChange writes the change as a server-sent event unless it's filtered out by country.
+// Deleted users don't have a country, so they're never filtered out.
+func writeChange(c *gin.Context, change *service.Change, country string) {
+	if country != "" && change.User != nil &&
+		change.User.Country != country && (change.Previous == nil || change.Previous.Country != country) {
+		return
+	}
+
+	uc := userChange{
+		Type:        string(change.Type),
+		UserID:      change.UserID,
+		UserVersion: change.Version,
+	}
+	if change.User != nil {
+		user := userToREST(change.User)
+		uc.User = &user
+	}
+	data, err := json.Marshal(uc)
+	if err != nil {
+		log.For(c.Request.Context()).Errorf("Can't marshal change %d: %s", change.ID, err)
+		return
+	}
+
+	fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", change.ID, change.Type, data)
+}
+
+// userChange is the data of the events sent by the changes stream
+type userChange struct {
+	Type        string `json:"type"`
+	UserID      string `json:"user_id"`
+	UserVersion int64  `json:"user_version"`
+	// User is the state of the user after the change, it's not provided for the deleted ones
+	User *restuser.User `json:"user,omitempty"`
+}
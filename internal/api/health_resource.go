@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/a-faceit-candidate/userservice/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthResource handles /health resource
+type HealthResource struct {
+	registry *health.Registry
+}
+
+func NewHealthResource(registry *health.Registry) *HealthResource {
+	return &HealthResource{
+		registry: registry,
+	}
+}
+
+func (res *HealthResource) AddRoutes(r gin.IRouter) {
+	base := r.Group("/health")
+	base.GET("/live", res.live)
+	base.GET("/ready", res.ready)
+}
+
+// live only checks that the service is able to serve requests, the dependencies aren't checked,
+// so the service isn't restarted when one of them is unavailable.
+func (res *HealthResource) live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// ready fails with 503 while a critical check is failing, or once the service is shutting down
+func (res *HealthResource) ready(c *gin.Context) {
+	report := res.registry.Check()
+	if !report.Ready() {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/a-faceit-candidate/restuser"
@@ -20,14 +23,24 @@ import (
 // we don't want to map those context.Canceled error to 5xx as they're a client-side error.
 const httpStatusRequestCanceled = 499
 
+// mergePatchContentType is the content type of the JSON merge patch documents, as defined by RFC 7386
+const mergePatchContentType = "application/merge-patch+json"
+
 // UsersResource handles /users resource
 type UsersResource struct {
-	svc service.Service
+	svc     service.Service
+	changes *service.ChangeFeed
+	// unpaginatedList lists all the users in a plain array when no pagination params are provided
+	unpaginatedList bool
 }
 
-func NewUsersResource(svc service.Service) *UsersResource {
+// NewUsersResource creates the resource, unpaginatedList keeps the plain array response with all the users
+// for the requests without pagination params, otherwise they receive the first page.
+func NewUsersResource(svc service.Service, changes *service.ChangeFeed, unpaginatedList bool) *UsersResource {
 	return &UsersResource{
-		svc: svc,
+		svc:             svc,
+		changes:         changes,
+		unpaginatedList: unpaginatedList,
 	}
 }
 
@@ -37,7 +50,20 @@ func (res *UsersResource) AddRoutes(r gin.IRouter) {
 	base.GET("/:id", res.getByID)
 	base.DELETE("/:id", res.deleteByID)
 	base.PUT("/:id", res.putByID)
+	base.PATCH("/:id", res.patchByID)
 	base.POST("/", res.post)
+	base.POST("/:id/password/verify", res.verifyPasswordByID)
+	base.POST("/:id/restore", res.restoreByID)
+
+	// gin doesn't allow static paths at the same level as :id, so the routes that aren't about a single user
+	// live in sibling /user-* groups instead of /users
+	r.POST("/user-password/verify", res.verifyPasswordByEmail)
+}
+
+// AddCredentialsExportRoutes adds the routes that expose the password hashes of the users.
+// These are not added by AddRoutes as they should only be enabled when migrating users to another system.
+func (res *UsersResource) AddCredentialsExportRoutes(r gin.IRouter) {
+	r.GET("/users/:id/credentials", res.getCredentialsByID)
 }
 
 func (res *UsersResource) post(c *gin.Context) {
@@ -58,44 +84,115 @@ func (res *UsersResource) post(c *gin.Context) {
 
 	user, err = res.svc.Create(ctx, user)
 	if err != nil {
-		res.handleError(ctx, c, err)
+		handleError(ctx, c, err)
 		return
 	}
 
 	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": user.ID})
 	log.For(ctx).Info("Successfully created user")
 
+	c.Header("ETag", etag(user))
 	c.JSON(http.StatusCreated, userToREST(user))
 }
 
 func (res *UsersResource) getByID(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
+	// gin doesn't allow static paths at same level as :id, so /users/changes is handled here
+	if id == changesPath {
+		res.getChanges(c)
+		return
+	}
 	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": id})
 
 	user, err := res.svc.Get(ctx, id)
 	if err != nil {
-		res.handleError(ctx, c, err)
+		handleError(ctx, c, err)
+		return
+	}
+
+	tag := etag(user)
+	c.Header("ETag", tag)
+	if etagMatchesAny(tag, c.GetHeader("If-None-Match")) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
 	c.JSON(http.StatusOK, userToREST(user))
 }
 
+func (res *UsersResource) getCredentialsByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": id})
+
+	user, err := res.svc.ExportCredentials(ctx, id)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userCredentials{
+		ID:           user.ID,
+		PasswordHash: user.PasswordHash,
+		PasswordSalt: user.PasswordSalt,
+	})
+}
+
+// deleteByID deletes the user, if the updated_at query param is provided, the user is only deleted if it wasn't modified
+// since then, failing with a conflict otherwise, like PUT does. If-Match header takes precedence over it.
 func (res *UsersResource) deleteByID(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
 	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": id})
 
-	err := res.svc.Delete(ctx, id)
+	expectedUpdatedAt, ok := ifMatchUpdatedAt(c)
+	if !ok {
+		return
+	}
+	conditional := !expectedUpdatedAt.IsZero()
+
+	if updatedAtParam := c.Query("updated_at"); updatedAtParam != "" && !conditional {
+		var err error
+		expectedUpdatedAt, err = time.Parse(time.RFC3339, updatedAtParam)
+		if err != nil {
+			log.For(ctx).Infof("Received a malformed updated_at: %s", err)
+			c.JSON(http.StatusBadRequest, errorResponse("Can't parse updated_at: %s", err))
+			return
+		}
+	}
+
+	var err error
+	if expectedUpdatedAt.IsZero() {
+		err = res.svc.Delete(ctx, id)
+	} else {
+		err = res.svc.DeleteVersioned(ctx, id, expectedUpdatedAt)
+	}
 	if err != nil {
-		res.handleError(ctx, c, err)
+		handleConditionalError(ctx, c, err, conditional)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+func (res *UsersResource) restoreByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": id})
+
+	user, err := res.svc.Restore(ctx, id)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	log.For(ctx).Info("Successfully restored user")
+
+	c.Header("ETag", etag(user))
+	c.JSON(http.StatusOK, userToREST(user))
+}
+
 func (res *UsersResource) putByID(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
@@ -115,20 +212,142 @@ func (res *UsersResource) putByID(c *gin.Context) {
 		return
 	}
 
+	expectedUpdatedAt, ok := ifMatchUpdatedAt(c)
+	if !ok {
+		return
+	}
+	if !expectedUpdatedAt.IsZero() {
+		user.UpdatedAt = expectedUpdatedAt
+	}
+
 	user, err = res.svc.Update(ctx, id, user)
 	if err != nil {
-		res.handleError(ctx, c, err)
+		handleConditionalError(ctx, c, err, !expectedUpdatedAt.IsZero())
 		return
 	}
 
 	log.For(ctx).Info("Successfully updated user")
 
+	c.Header("ETag", etag(user))
+	c.JSON(http.StatusOK, userToREST(user))
+}
+
+func (res *UsersResource) patchByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": id})
+
+	if c.ContentType() != mergePatchContentType {
+		c.JSON(http.StatusUnsupportedMediaType, errorResponse("Content-Type should be %s", mergePatchContentType))
+		return
+	}
+
+	doc := map[string]json.RawMessage{}
+	if err := c.BindJSON(&doc); err != nil {
+		log.For(ctx).Infof("Received a malformed payload: %s", err)
+		c.JSON(http.StatusBadRequest, errorResponse("Can't bind request payload: %s", err))
+		return
+	}
+
+	patch, err := mergePatchToUserPatch(doc)
+	if err != nil {
+		log.For(ctx).Infof("Can't map merge patch to internal: %s", err)
+		c.JSON(http.StatusBadRequest, errorResponse("Can't map merge patch: %s", err))
+		return
+	}
+
+	expectedUpdatedAt, ok := ifMatchUpdatedAt(c)
+	if !ok {
+		return
+	}
+	if !expectedUpdatedAt.IsZero() {
+		patch.UpdatedAt = expectedUpdatedAt
+	}
+
+	user, err := res.svc.Patch(ctx, id, patch)
+	if err != nil {
+		handleConditionalError(ctx, c, err, !expectedUpdatedAt.IsZero())
+		return
+	}
+
+	log.For(ctx).Info("Successfully patched user")
+
+	c.Header("ETag", etag(user))
 	c.JSON(http.StatusOK, userToREST(user))
 }
 
+func (res *UsersResource) verifyPasswordByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"user_id": id})
+
+	req := &passwordVerificationRequest{}
+	if err := c.BindJSON(req); err != nil {
+		log.For(ctx).Infof("Received a malformed payload: %s", err)
+		c.JSON(http.StatusBadRequest, errorResponse("Can't bind request payload: %s", err))
+		return
+	}
+
+	match, err := res.svc.VerifyPassword(ctx, id, req.Password)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, passwordVerificationResponse{Match: match})
+}
+
+func (res *UsersResource) verifyPasswordByEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	req := &passwordVerificationRequest{}
+	if err := c.BindJSON(req); err != nil {
+		log.For(ctx).Infof("Received a malformed payload: %s", err)
+		c.JSON(http.StatusBadRequest, errorResponse("Can't bind request payload: %s", err))
+		return
+	}
+	if req.Email == "" {
+		c.JSON(http.StatusBadRequest, errorResponse("email should be provided"))
+		return
+	}
+
+	match, err := res.svc.VerifyPasswordByEmail(ctx, req.Email, req.Password)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, passwordVerificationResponse{Match: match})
+}
+
+// get lists the users, optionally filtered by country.
+// The response is a page of users with the cursor for the next page, up to service.DefaultPageLimit unless limit is provided.
+// If the unpaginated list is enabled and neither limit nor cursor are provided, all users are returned in a plain array,
+// which is kept for compatibility with previous clients.
+// If email query param is provided, the array will contain just the user with that email, if any.
+// Deleted users are only listed if include_deleted=true is provided, they can be identified by their deleted_at field.
 func (res *UsersResource) get(c *gin.Context) {
+	if email := c.Query("email"); email != "" {
+		res.getByEmail(c, email)
+		return
+	}
+
+	_, paginated := c.GetQuery("limit")
+	if _, ok := c.GetQuery("cursor"); ok {
+		paginated = true
+	}
+	if paginated || !res.unpaginatedList {
+		res.getPage(c)
+		return
+	}
+
 	ctx := c.Request.Context()
 
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+
 	var (
 		users []*model.User
 		err   error
@@ -137,38 +356,119 @@ func (res *UsersResource) get(c *gin.Context) {
 	country := c.Query("country")
 	if country != "" {
 		ctx = log.WithValues(ctx, map[string]interface{}{"country": country})
-		users, err = res.svc.ListCountry(ctx, country)
+		users, err = res.svc.ListCountry(ctx, country, includeDeleted)
 	} else {
-		users, err = res.svc.ListAll(ctx)
+		users, err = res.svc.ListAll(ctx, includeDeleted)
 	}
 
 	if err != nil {
-		res.handleInternalError(ctx, c, err)
+		handleInternalError(ctx, c, err)
 		return
 	}
 
-	restUsers := make([]restuser.User, len(users))
-	for i, u := range users {
-		restUsers[i] = userToREST(u)
+	c.JSON(http.StatusOK, usersToREST(users))
+}
+
+func (res *UsersResource) getByEmail(c *gin.Context, email string) {
+	ctx := c.Request.Context()
+
+	user, err := res.svc.GetByEmail(ctx, email)
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusOK, []restuser.User{})
+		return
+	} else if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, []restuser.User{userToREST(user)})
+}
+
+func (res *UsersResource) getPage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var limit int
+	if limitParam := c.Query("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil {
+			log.For(ctx).Infof("Received a malformed limit: %s", err)
+			c.JSON(http.StatusBadRequest, errorResponse("Can't parse limit: %s", err))
+			return
+		}
 	}
+	cursor := c.Query("cursor")
 
-	c.JSON(http.StatusOK, restUsers)
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+
+	var (
+		users      []*model.User
+		nextCursor string
+		err        error
+	)
+
+	country := c.Query("country")
+	if country != "" {
+		ctx = log.WithValues(ctx, map[string]interface{}{"country": country})
+		users, nextCursor, err = res.svc.ListCountryPage(ctx, country, cursor, limit, includeDeleted)
+	} else {
+		users, nextCursor, err = res.svc.ListAllPage(ctx, cursor, limit, includeDeleted)
+	}
+
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usersPage{
+		Users:      usersToREST(users),
+		NextCursor: nextCursor,
+	})
+}
+
+// includeDeletedParam parses the include_deleted query param, responding and returning false if it's malformed
+func includeDeletedParam(c *gin.Context) (includeDeleted, ok bool) {
+	param := c.Query("include_deleted")
+	if param == "" {
+		return false, true
+	}
+	includeDeleted, err := strconv.ParseBool(param)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse("Can't parse include_deleted: %s", err))
+		return false, false
+	}
+	return includeDeleted, true
 }
 
-func (res *UsersResource) handleError(ctx context.Context, c *gin.Context, err error) {
-	if res.handleServiceError(ctx, c, err) {
+func handleError(ctx context.Context, c *gin.Context, err error) {
+	if handleServiceError(ctx, c, err) {
 		return
 	}
-	res.handleInternalError(ctx, c, err)
+	handleInternalError(ctx, c, err)
+}
+
+// handleConditionalError works like handleError, but if the request had an If-Match precondition, a conflict means
+// that the precondition has failed.
+func handleConditionalError(ctx context.Context, c *gin.Context, err error, conditional bool) {
+	if conditional && errors.Is(err, service.ErrConflict) {
+		c.JSON(http.StatusPreconditionFailed, errorResponse(err.Error()))
+		return
+	}
+	handleError(ctx, c, err)
 }
 
 var serviceErrorToStatusCode = map[error]int{
-	service.ErrNotFound:      http.StatusNotFound,
-	service.ErrInvalidParams: http.StatusBadRequest,
-	service.ErrConflict:      http.StatusConflict,
+	service.ErrNotFound:           http.StatusNotFound,
+	service.ErrInvalidParams:      http.StatusBadRequest,
+	service.ErrConflict:           http.StatusConflict,
+	service.ErrEmailInUse:         http.StatusConflict,
+	service.ErrEmailOfDeletedUser: http.StatusConflict,
 }
 
-func (res *UsersResource) handleServiceError(_ context.Context, c *gin.Context, err error) bool {
+func handleServiceError(_ context.Context, c *gin.Context, err error) bool {
 	for svcErr, statusCode := range serviceErrorToStatusCode {
 		if errors.Is(err, svcErr) {
 			c.JSON(statusCode, errorResponse(err.Error()))
@@ -178,7 +478,7 @@ func (res *UsersResource) handleServiceError(_ context.Context, c *gin.Context,
 	return false
 }
 
-func (res *UsersResource) handleInternalError(ctx context.Context, c *gin.Context, err error) {
+func handleInternalError(ctx context.Context, c *gin.Context, err error) {
 	if errors.Is(err, context.Canceled) {
 		c.Status(httpStatusRequestCanceled)
 		return
@@ -218,20 +518,162 @@ func restToUser(ru *restuser.User) (u *model.User, err error) {
 	}, nil
 }
 
+// etag provides the strong entity tag of the user, which is derived from UpdatedAt as it changes on every update
+func etag(u *model.User) string {
+	return strconv.Quote(strconv.FormatInt(u.UpdatedAt.UnixNano(), 36))
+}
+
+// parseETag provides the UpdatedAt a strong entity tag generated by etag was derived from
+func parseETag(tag string) (time.Time, error) {
+	tag = strings.TrimSpace(tag)
+	if strings.HasPrefix(tag, "W/") {
+		return time.Time{}, fmt.Errorf("weak entity tags can't be used for preconditions")
+	}
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("entity tag should be quoted")
+	}
+	nanos, err := strconv.ParseInt(unquoted, 36, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown entity tag %s", tag)
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// etagMatchesAny performs the weak comparison of the tag against the If-None-Match header value, as defined by RFC 7232
+func etagMatchesAny(tag, ifNoneMatch string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchUpdatedAt returns the UpdatedAt required by the If-Match header, or a zero time if there's no such requirement.
+// If the header can't be satisfied, it responds and returns false.
+// Only one entity tag is supported, as that's what the optimistic concurrency control of the service can check.
+func ifMatchUpdatedAt(c *gin.Context) (time.Time, bool) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		// we only modify existing users, so "*" is always satisfied
+		return time.Time{}, true
+	}
+	if strings.Contains(ifMatch, ",") {
+		c.JSON(http.StatusBadRequest, errorResponse("Only one entity tag is supported in If-Match"))
+		return time.Time{}, false
+	}
+	updatedAt, err := parseETag(ifMatch)
+	if err != nil {
+		// a tag we can't parse won't ever match the current one
+		c.JSON(http.StatusPreconditionFailed, errorResponse("If-Match can't be satisfied: %s", err))
+		return time.Time{}, false
+	}
+	return updatedAt, true
+}
+
+// mergePatchToUserPatch maps a JSON merge patch document to the internal patch model.
+// A null member would remove the field, which isn't possible as all of them are required, so it's rejected, as well
+// as the fields that can't be modified by the clients. The only exception is updated_at, which is used as the
+// expected version of the user, like in the PUT requests.
+func mergePatchToUserPatch(doc map[string]json.RawMessage) (*model.UserPatch, error) {
+	patch := &model.UserPatch{}
+	fields := map[string]**string{
+		"first_name": &patch.FirstName,
+		"last_name":  &patch.LastName,
+		"name":       &patch.Name,
+		"email":      &patch.Email,
+		"password":   &patch.Password,
+		"country":    &patch.Country,
+	}
+
+	for key, raw := range doc {
+		if key == "updated_at" {
+			var updatedAt string
+			if err := json.Unmarshal(raw, &updatedAt); err != nil {
+				return nil, fmt.Errorf("can't parse updated_at: %w", err)
+			}
+			parsed, err := time.Parse(time.RFC3339, updatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("can't parse updated_at: %w", err)
+			}
+			patch.UpdatedAt = parsed
+			continue
+		}
+
+		dst, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("%s can't be patched", key)
+		}
+		if string(raw) == "null" {
+			return nil, fmt.Errorf("%s can't be removed", key)
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("can't parse %s: %w", key, err)
+		}
+		*dst = &value
+	}
+	return patch, nil
+}
+
 func userToREST(u *model.User) restuser.User {
 	return restuser.User{
-		ID:           u.ID,
-		CreatedAt:    u.CreatedAt.Format(time.RFC3339Nano),
-		UpdatedAt:    u.UpdatedAt.Format(time.RFC3339Nano),
-		FirstName:    u.FirstName,
-		LastName:     u.LastName,
-		Name:         u.Name,
-		Email:        u.Email,
-		Password:     u.Password,
-		PasswordHash: u.PasswordHash,
-		PasswordSalt: u.PasswordSalt,
-		Country:      u.Country,
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339Nano),
+		UpdatedAt: u.UpdatedAt.Format(time.RFC3339Nano),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Name:      u.Name,
+		Email:     u.Email,
+		Country:   u.Country,
+	}
+}
+
+func usersToREST(users []*model.User) []listedUser {
+	restUsers := make([]listedUser, len(users))
+	for i, u := range users {
+		restUsers[i] = listedUser{User: userToREST(u)}
+		if !u.DeletedAt.IsZero() {
+			restUsers[i].DeletedAt = u.DeletedAt.Format(time.RFC3339Nano)
+		}
 	}
+	return restUsers
+}
+
+// listedUser is the user returned by the list endpoints, which can include the deleted users when requested
+type listedUser struct {
+	restuser.User
+	DeletedAt string `json:"deleted_at,omitempty"`
+}
+
+// usersPage is the paginated response for the users list
+type usersPage struct {
+	Users []listedUser `json:"users"`
+	// NextCursor should be provided as the cursor to retrieve next page, it's empty when there are no more pages
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// passwordVerificationRequest is the payload of the password verification endpoints.
+// Email is only used when the user isn't identified by the path.
+type passwordVerificationRequest struct {
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password" binding:"required"`
+}
+
+type passwordVerificationResponse struct {
+	Match bool `json:"match"`
+}
+
+// userCredentials is the response of the credentials export endpoint.
+// PasswordSalt is only set for the hashes generated by previous versions of this service.
+type userCredentials struct {
+	ID           string `json:"id"`
+	PasswordHash string `json:"password_hash"`
+	PasswordSalt string `json:"password_salt,omitempty"`
 }
 
 func errorResponse(msg string, args ...interface{}) restuser.ErrorResponse {
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// WebhooksResource handles /webhooks resource
+type WebhooksResource struct {
+	svc service.WebhookService
+}
+
+func NewWebhooksResource(svc service.WebhookService) *WebhooksResource {
+	return &WebhooksResource{
+		svc: svc,
+	}
+}
+
+func (res *WebhooksResource) AddRoutes(r gin.IRouter) {
+	base := r.Group("/webhooks")
+	base.GET("/", res.get)
+	base.POST("/", res.post)
+	base.GET("/:id", res.getByID)
+	base.DELETE("/:id", res.deleteByID)
+	base.POST("/:id/enable", res.enableByID)
+	base.GET("/:id/deliveries", res.getDeliveriesByID)
+}
+
+// post registers a webhook, its secret is only included in this response
+func (res *WebhooksResource) post(c *gin.Context) {
+	ctx := c.Request.Context()
+	req := &webhookRequest{}
+	if err := c.BindJSON(req); err != nil {
+		log.For(ctx).Infof("Received a malformed payload: %s", err)
+		c.JSON(http.StatusBadRequest, errorResponse("Can't bind request payload: %s", err))
+		return
+	}
+
+	webhook, err := res.svc.CreateWebhook(ctx, &model.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+	})
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	rw := webhookToREST(webhook)
+	rw.Secret = webhook.Secret
+	c.JSON(http.StatusCreated, rw)
+}
+
+func (res *WebhooksResource) get(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	webhooks, err := res.svc.ListWebhooks(ctx)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	restWebhooks := make([]restWebhook, len(webhooks))
+	for i, w := range webhooks {
+		restWebhooks[i] = webhookToREST(w)
+	}
+	c.JSON(http.StatusOK, restWebhooks)
+}
+
+func (res *WebhooksResource) getByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"webhook_id": id})
+
+	webhook, err := res.svc.GetWebhook(ctx, id)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookToREST(webhook))
+}
+
+func (res *WebhooksResource) deleteByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"webhook_id": id})
+
+	if err := res.svc.DeleteWebhook(ctx, id); err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// enableByID enables again a webhook that was disabled after failing too many times
+func (res *WebhooksResource) enableByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"webhook_id": id})
+
+	webhook, err := res.svc.EnableWebhook(ctx, id)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookToREST(webhook))
+}
+
+// getDeliveriesByID lists the last delivery attempts of the webhook, up to the limit query param
+func (res *WebhooksResource) getDeliveriesByID(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	ctx = log.WithValues(ctx, map[string]interface{}{"webhook_id": id})
+
+	var limit int
+	if limitParam := c.Query("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil {
+			log.For(ctx).Infof("Received a malformed limit: %s", err)
+			c.JSON(http.StatusBadRequest, errorResponse("Can't parse limit: %s", err))
+			return
+		}
+	}
+
+	deliveries, err := res.svc.ListWebhookDeliveries(ctx, id, limit)
+	if err != nil {
+		handleError(ctx, c, err)
+		return
+	}
+
+	restDeliveries := make([]restWebhookDelivery, len(deliveries))
+	for i, d := range deliveries {
+		restDeliveries[i] = restWebhookDelivery{
+			ID:         d.ID,
+			CreatedAt:  d.CreatedAt.Format(time.RFC3339Nano),
+			DeliveryID: d.DeliveryID,
+			Event:      d.Topic,
+			Attempt:    d.Attempt,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+			DurationMs: d.Duration.Milliseconds(),
+		}
+	}
+	c.JSON(http.StatusOK, restDeliveries)
+}
+
+func webhookToREST(w *model.Webhook) restWebhook {
+	rw := restWebhook{
+		ID:                  w.ID,
+		CreatedAt:           w.CreatedAt.Format(time.RFC3339Nano),
+		UpdatedAt:           w.UpdatedAt.Format(time.RFC3339Nano),
+		URL:                 w.URL,
+		Events:              w.Events,
+		ConsecutiveFailures: w.ConsecutiveFailures,
+	}
+	if !w.DisabledAt.IsZero() {
+		rw.DisabledAt = w.DisabledAt.Format(time.RFC3339Nano)
+	}
+	return rw
+}
+
+// webhookRequest is the payload to register a webhook, a secret is generated if it's not provided
+type webhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// restWebhook is the webhook returned by the API, its Secret is only provided when it's created
+type restWebhook struct {
+	ID                  string   `json:"id"`
+	CreatedAt           string   `json:"created_at"`
+	UpdatedAt           string   `json:"updated_at"`
+	URL                 string   `json:"url"`
+	Secret              string   `json:"secret,omitempty"`
+	Events              []string `json:"events,omitempty"`
+	ConsecutiveFailures int      `json:"consecutive_failures"`
+	DisabledAt          string   `json:"disabled_at,omitempty"`
+}
+
+type restWebhookDelivery struct {
+	ID         int64  `json:"id"`
+	CreatedAt  string `json:"created_at"`
+	DeliveryID string `json:"delivery_id"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
@@ -0,0 +1,132 @@
+package command
+
+import (
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+)
+
+// Type is the operation requested by a Command
+type Type string
+
+const (
+	TypeCreate Type = "create"
+	// TypeUpdate changes only the provided fields of the user, like a PATCH request
+	TypeUpdate Type = "update"
+	// TypeDelete marks the user as deleted, so it can be restored until it's purged
+	TypeDelete Type = "delete"
+	// TypeErase permanently deletes the user, it's intended for the erasure requests, like the GDPR ones
+	TypeErase Type = "erase"
+)
+
+// Command is the message consumed from the commands topic
+type Command struct {
+	// ID is provided by the sender, and it's included in the reply so it can be correlated
+	ID     string `json:"id"`
+	Type   Type   `json:"type"`
+	UserID string `json:"user_id,omitempty"`
+	// UpdatedAt is the expected updated_at of the user being updated or deleted, it's optional
+	UpdatedAt string `json:"updated_at,omitempty"`
+	// User contains the fields of the user being created, or the fields being changed by an update
+	User *Fields `json:"user,omitempty"`
+}
+
+// Fields of the user that can be provided by a command, nil ones are not changed by an update
+type Fields struct {
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Name      *string `json:"name,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	Password  *string `json:"password,omitempty"`
+	Country   *string `json:"country,omitempty"`
+}
+
+// Reply is published to the replies topic once the command is executed, successfully or not
+type Reply struct {
+	CommandID string `json:"command_id"`
+	Type      Type   `json:"type"`
+	UserID    string `json:"user_id,omitempty"`
+	Success   bool   `json:"success"`
+	// User is the state of the user after a successful create or update
+	User *User `json:"user,omitempty"`
+	// Error is one of the Error* constants
+	Error        string `json:"error,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+const (
+	ErrorNotFound      = "not_found"
+	ErrorInvalidParams = "invalid_params"
+	ErrorConflict      = "conflict"
+	ErrorEmailInUse    = "email_in_use"
+	// ErrorEmailOfDeletedUser means that the email belongs to a deleted user, which should be restored instead
+	ErrorEmailOfDeletedUser = "email_of_deleted_user"
+)
+
+// User is the user model of the replies, it never contains the password or its hash
+type User struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Country   string `json:"country"`
+}
+
+// DeadLetter is published to the dead letter topic when a message can't be handled
+type DeadLetter struct {
+	// Body is the original message with the user password redacted, it may not be a valid command.
+	// It's empty if the message isn't a JSON object, as it can't be redacted then, BodySHA256 is provided instead.
+	Body       string `json:"body,omitempty"`
+	BodySHA256 string `json:"body_sha256,omitempty"`
+	Error      string `json:"error"`
+	Attempts   uint16 `json:"attempts"`
+}
+
+// redactedPassword replaces the passwords of the commands sent to the dead letter topic
+const redactedPassword = `"REDACTED"`
+
+func fieldsToUser(f *Fields) *model.User {
+	return &model.User{
+		FirstName: stringOrEmpty(f.FirstName),
+		LastName:  stringOrEmpty(f.LastName),
+		Name:      stringOrEmpty(f.Name),
+		Email:     stringOrEmpty(f.Email),
+		Password:  stringOrEmpty(f.Password),
+		Country:   stringOrEmpty(f.Country),
+	}
+}
+
+func fieldsToPatch(f *Fields, updatedAt time.Time) *model.UserPatch {
+	return &model.UserPatch{
+		UpdatedAt: updatedAt,
+		FirstName: f.FirstName,
+		LastName:  f.LastName,
+		Name:      f.Name,
+		Email:     f.Email,
+		Password:  f.Password,
+		Country:   f.Country,
+	}
+}
+
+func userToReply(u *model.User) *User {
+	return &User{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339Nano),
+		UpdatedAt: u.UpdatedAt.Format(time.RFC3339Nano),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Name:      u.Name,
+		Email:     u.Email,
+		Country:   u.Country,
+	}
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
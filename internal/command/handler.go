@@ -0,0 +1,202 @@
+package command
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/service"
+	"github.com/nsqio/go-nsq"
+)
+
+// Config configures the consumption of the commands
+type Config struct {
+	// Enabled subscribes the service to the commands topic
+	Enabled bool
+	Topic   string `default:"user.commands"`
+	Channel string `default:"userservice"`
+	// RepliesTopic receives a Reply for each executed command
+	RepliesTopic string `default:"user.commands.replies"`
+	// DeadLetterTopic receives the messages that aren't valid commands, or that failed MaxAttempts times
+	DeadLetterTopic string `default:"user.commands.dead"`
+	// MaxAttempts is the number of times a command is tried when it fails due to an internal error
+	MaxAttempts uint16 `default:"5"`
+	// Concurrency is the amount of commands executed concurrently
+	Concurrency int `default:"1"`
+}
+
+//go:generate mockery -inpkg -testonly -case underscore -name publisher
+type publisher interface {
+	Publish(topic string, body []byte) error
+}
+
+// Handler implements the nsq.Handler executing the consumed commands through the service
+type Handler struct {
+	svc       service.Service
+	publisher publisher
+	cfg       Config
+}
+
+// NewHandler provides a Handler publishing the replies and dead letters through the publisher provided
+func NewHandler(svc service.Service, publisher publisher, cfg Config) *Handler {
+	return &Handler{
+		svc:       svc,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+var serviceErrorToReplyError = map[error]string{
+	service.ErrNotFound:           ErrorNotFound,
+	service.ErrInvalidParams:      ErrorInvalidParams,
+	service.ErrConflict:           ErrorConflict,
+	service.ErrEmailInUse:         ErrorEmailInUse,
+	service.ErrEmailOfDeletedUser: ErrorEmailOfDeletedUser,
+}
+
+// HandleMessage only returns an error to have the message requeued, which happens when the command failed due to an
+// internal error, like the database being unavailable, and it wasn't tried MaxAttempts times yet.
+// Failures due to the command itself, like a not found user, are replied instead.
+func (h *Handler) HandleMessage(msg *nsq.Message) error {
+	var cmd Command
+	if err := json.Unmarshal(msg.Body, &cmd); err != nil {
+		return h.deadLetter(context.Background(), msg, fmt.Errorf("can't unmarshal command: %w", err))
+	}
+
+	ctx := log.WithValues(context.Background(), map[string]interface{}{
+		"command_id":   cmd.ID,
+		"command_type": cmd.Type,
+	})
+
+	reply, err := h.execute(ctx, &cmd)
+	if err != nil {
+		for svcErr, replyErr := range serviceErrorToReplyError {
+			if errors.Is(err, svcErr) {
+				reply = &Reply{UserID: cmd.UserID, Error: replyErr, ErrorMessage: err.Error()}
+				break
+			}
+		}
+	}
+	if reply == nil {
+		if msg.Attempts < h.cfg.MaxAttempts {
+			log.For(ctx).Warningf("Can't execute command, attempt %d: %s", msg.Attempts, err)
+			return err
+		}
+		return h.deadLetter(ctx, msg, err)
+	}
+
+	reply.CommandID = cmd.ID
+	reply.Type = cmd.Type
+	reply.Success = reply.Error == ""
+	h.publish(ctx, h.cfg.RepliesTopic, reply)
+	return nil
+}
+
+// execute returns a nil reply with an error if the command can't be executed
+func (h *Handler) execute(ctx context.Context, cmd *Command) (*Reply, error) {
+	var updatedAt time.Time
+	if cmd.UpdatedAt != "" {
+		var err error
+		if updatedAt, err = time.Parse(time.RFC3339, cmd.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%w: can't parse updated_at: %s", service.ErrInvalidParams, err)
+		}
+	}
+	if cmd.Type != TypeCreate && cmd.UserID == "" {
+		return nil, fmt.Errorf("%w: user_id should be provided", service.ErrInvalidParams)
+	}
+	if (cmd.Type == TypeCreate || cmd.Type == TypeUpdate) && cmd.User == nil {
+		return nil, fmt.Errorf("%w: user should be provided", service.ErrInvalidParams)
+	}
+
+	var user *model.User
+	var err error
+	switch cmd.Type {
+	case TypeCreate:
+		user, err = h.svc.Create(ctx, fieldsToUser(cmd.User))
+	case TypeUpdate:
+		user, err = h.svc.Patch(ctx, cmd.UserID, fieldsToPatch(cmd.User, updatedAt))
+	case TypeDelete:
+		if updatedAt.IsZero() {
+			err = h.svc.Delete(ctx, cmd.UserID)
+		} else {
+			err = h.svc.DeleteVersioned(ctx, cmd.UserID, updatedAt)
+		}
+	case TypeErase:
+		err = h.svc.Erase(ctx, cmd.UserID)
+	default:
+		err = fmt.Errorf("%w: unknown command type %q", service.ErrInvalidParams, cmd.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &Reply{UserID: cmd.UserID}
+	if user != nil {
+		reply.UserID = user.ID
+		reply.User = userToReply(user)
+	}
+	return reply, nil
+}
+
+// deadLetter never fails, so the message is finished
+func (h *Handler) deadLetter(ctx context.Context, msg *nsq.Message, err error) error {
+	log.For(ctx).Errorf("Sending message to dead letter topic after %d attempts: %s", msg.Attempts, err)
+	dl := &DeadLetter{
+		Error:    err.Error(),
+		Attempts: msg.Attempts,
+	}
+	if body, ok := redactPassword(msg.Body); ok {
+		dl.Body = body
+	} else {
+		sum := sha256.Sum256(msg.Body)
+		dl.BodySHA256 = hex.EncodeToString(sum[:])
+	}
+	h.publish(ctx, h.cfg.DeadLetterTopic, dl)
+	return nil
+}
+
+// redactPassword replaces the user password of the message, if any, so it doesn't end up in the dead letter topic.
+// It fails if the message isn't a JSON object with an object or null user, as it can't know where the password is then.
+func redactPassword(body []byte) (string, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", false
+	}
+	var user map[string]json.RawMessage
+	if raw, ok := fields["user"]; ok {
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return "", false
+		}
+	}
+	if _, ok := user["password"]; !ok {
+		return string(body), true
+	}
+
+	user["password"] = json.RawMessage(redactedPassword)
+	var err error
+	if fields["user"], err = json.Marshal(user); err != nil {
+		return "", false
+	}
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return "", false
+	}
+	return string(redacted), true
+}
+
+// publish only logs the errors, as the command was already executed and it shouldn't be executed again
+func (h *Handler) publish(ctx context.Context, topic string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err == nil {
+		err = h.publisher.Publish(topic, data)
+	}
+	if err != nil {
+		log.For(ctx).Errorf("Can't publish to %s: %s", topic, err)
+	}
+}
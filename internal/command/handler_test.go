@@ -0,0 +1,237 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/service"
+	"github.com/a-faceit-candidate/userservice/internal/service/servicemock"
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var cfg = Config{
+	RepliesTopic:    "replies",
+	DeadLetterTopic: "dead",
+	MaxAttempts:     3,
+}
+
+func TestHandler_HandleMessage(t *testing.T) {
+	someTime := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	someUser := &model.User{
+		ID:        "some-id",
+		CreatedAt: someTime,
+		UpdatedAt: someTime,
+		FirstName: "John",
+		LastName:  "Doe",
+		Name:      "john",
+		Email:     "john@example.com",
+		Country:   "uk",
+	}
+
+	message := func(body string, attempts uint16) *nsq.Message {
+		msg := nsq.NewMessage(nsq.MessageID{}, []byte(body))
+		msg.Attempts = attempts
+		return msg
+	}
+
+	expectPublished := func(t *testing.T, publisher *mockPublisher, topic string, payload interface{}) {
+		publisher.On("Publish", topic, mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+			expected, err := json.Marshal(payload)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(args.Get(1).([]byte)))
+		})
+	}
+
+	t.Run("create", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("Create", mock.Anything, &model.User{FirstName: "John", LastName: "Doe", Name: "john", Email: "john@example.com", Password: "secret", Country: "uk"}).Return(someUser, nil).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{
+			CommandID: "cmd",
+			Type:      TypeCreate,
+			UserID:    "some-id",
+			Success:   true,
+			User:      userToReply(someUser),
+		})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"create","user":{"first_name":"John","last_name":"Doe","name":"john","email":"john@example.com","password":"secret","country":"uk"}}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		country := "es"
+		svc := &servicemock.Service{}
+		svc.On("Patch", mock.Anything, "some-id", &model.UserPatch{UpdatedAt: someTime, Country: &country}).Return(someUser, nil).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{
+			CommandID: "cmd",
+			Type:      TypeUpdate,
+			UserID:    "some-id",
+			Success:   true,
+			User:      userToReply(someUser),
+		})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"update","user_id":"some-id","updated_at":"2020-10-01T12:00:00Z","user":{"country":"es"}}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("Delete", mock.Anything, "some-id").Return(nil).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{CommandID: "cmd", Type: TypeDelete, UserID: "some-id", Success: true})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"delete","user_id":"some-id"}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("versioned delete", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("DeleteVersioned", mock.Anything, "some-id", someTime).Return(nil).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{CommandID: "cmd", Type: TypeDelete, UserID: "some-id", Success: true})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"delete","user_id":"some-id","updated_at":"2020-10-01T12:00:00Z"}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("Erase", mock.Anything, "some-id").Return(nil).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{CommandID: "cmd", Type: TypeErase, UserID: "some-id", Success: true})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"erase","user_id":"some-id"}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("business failure is replied", func(t *testing.T) {
+		err := fmt.Errorf("%w: user was modified", service.ErrConflict)
+		svc := &servicemock.Service{}
+		svc.On("Erase", mock.Anything, "some-id").Return(err).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{
+			CommandID:    "cmd",
+			Type:         TypeErase,
+			UserID:       "some-id",
+			Error:        ErrorConflict,
+			ErrorMessage: err.Error(),
+		})
+
+		err = NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"erase","user_id":"some-id"}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("email of a deleted user is replied", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("Create", mock.Anything, mock.Anything).Return(nil, service.ErrEmailOfDeletedUser).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "replies", &Reply{
+			CommandID:    "cmd",
+			Type:         TypeCreate,
+			Error:        ErrorEmailOfDeletedUser,
+			ErrorMessage: service.ErrEmailOfDeletedUser.Error(),
+		})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"create","user":{"email":"john@example.com","password":"secret"}}`, cfg.MaxAttempts))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("invalid command is replied", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		publisher.On("Publish", "replies", mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+			var reply Reply
+			assert.NoError(t, json.Unmarshal(args.Get(1).([]byte), &reply))
+			assert.Equal(t, "cmd", reply.CommandID)
+			assert.False(t, reply.Success)
+			assert.Equal(t, ErrorInvalidParams, reply.Error)
+		})
+
+		err := NewHandler(&servicemock.Service{}, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"explode","user_id":"some-id"}`, 1))
+		assert.NoError(t, err)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("internal failure is requeued", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("Erase", mock.Anything, "some-id").Return(assert.AnError).Once()
+
+		err := NewHandler(svc, &mockPublisher{}, cfg).HandleMessage(message(`{"id":"cmd","type":"erase","user_id":"some-id"}`, 1))
+		assert.Equal(t, assert.AnError, err)
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("internal failure is dead lettered after max attempts", func(t *testing.T) {
+		body := `{"id":"cmd","type":"erase","user_id":"some-id"}`
+		svc := &servicemock.Service{}
+		svc.On("Erase", mock.Anything, "some-id").Return(assert.AnError).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "dead", &DeadLetter{Body: body, Error: assert.AnError.Error(), Attempts: 3})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(body, 3))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("dead lettered commands don't contain the password", func(t *testing.T) {
+		body := `{"id":"cmd","type":"create","user":{"email":"foo@example.com","password":"secret"}}`
+		svc := &servicemock.Service{}
+		svc.On("Create", mock.Anything, mock.Anything).Return(nil, assert.AnError).Once()
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "dead", &DeadLetter{
+			Body:     `{"id":"cmd","type":"create","user":{"email":"foo@example.com","password":"REDACTED"}}`,
+			Error:    assert.AnError.Error(),
+			Attempts: 3,
+		})
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(body, 3))
+		assert.NoError(t, err)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("undecodable message is dead lettered", func(t *testing.T) {
+		publisher := &mockPublisher{}
+		expectPublished(t, publisher, "dead", &DeadLetter{
+			// sha256 of "not json", the message itself isn't kept as it can't be redacted
+			BodySHA256: "7ccfa1fbf3940e6f0c0375d87c0f9235a50514e14cb427bdfaf5077987b26ccf",
+			Error:      "can't unmarshal command: invalid character 'o' in literal null (expecting 'u')",
+			Attempts:   1,
+		})
+
+		err := NewHandler(&servicemock.Service{}, publisher, cfg).HandleMessage(message(`not json`, 1))
+		assert.NoError(t, err)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("reply publishing failure is not requeued", func(t *testing.T) {
+		svc := &servicemock.Service{}
+		svc.On("Erase", mock.Anything, "some-id").Return(nil).Once()
+		publisher := &mockPublisher{}
+		publisher.On("Publish", "replies", mock.Anything).Return(assert.AnError).Once()
+
+		err := NewHandler(svc, publisher, cfg).HandleMessage(message(`{"id":"cmd","type":"erase","user_id":"some-id"}`, 1))
+		assert.NoError(t, err)
+		svc.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+}
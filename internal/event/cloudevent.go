@@ -0,0 +1,56 @@
+package event
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification implemented by CloudEvent
+const CloudEventsSpecVersion = "1.0"
+
+// cloudEventTypePrefix is prepended to the envelope type, as CloudEvents types should be prefixed with a reverse-DNS name
+const cloudEventTypePrefix = "com.faceit."
+
+// CloudEvent is the payload of the events published with FormatCloudEvents, encoded in structured content mode.
+// See https://github.com/cloudevents/spec/blob/v1.0/spec.md
+type CloudEvent struct {
+	SpecVersion     string `json:"specversion"`
+	ID              string `json:"id"`
+	Source          string `json:"source"`
+	Type            string `json:"type"`
+	Subject         string `json:"subject"`
+	Time            string `json:"time"`
+	DataContentType string `json:"datacontenttype"`
+	// UserVersion is an extension attribute with the same meaning as the Envelope's UserVersion
+	UserVersion int64 `json:"userversion"`
+	// TraceParent and TraceState are the extension attributes of the distributed tracing extension
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
+	// Data is omitted for the deleted users, as there's nothing else to tell about them apart from the subject
+	Data *CloudEventData `json:"data,omitempty"`
+}
+
+// CloudEventData is the data of the CloudEvent, it has the same meaning as the Envelope fields
+type CloudEventData struct {
+	User          *User    `json:"user,omitempty"`
+	Previous      *User    `json:"previous,omitempty"`
+	ChangedFields []string `json:"changed_fields,omitempty"`
+}
+
+func envelopeToCloudEvent(envelope *Envelope, source string) *CloudEvent {
+	ce := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              envelope.ID,
+		Source:          source,
+		Type:            cloudEventTypePrefix + envelope.Type,
+		Subject:         envelope.UserID,
+		Time:            envelope.Time,
+		DataContentType: "application/json",
+		UserVersion:     envelope.UserVersion,
+		TraceParent:     envelope.TraceParent,
+		TraceState:      envelope.TraceState,
+	}
+	if envelope.User != nil || envelope.Previous != nil {
+		ce.Data = &CloudEventData{
+			User:          envelope.User,
+			Previous:      envelope.Previous,
+			ChangedFields: envelope.ChangedFields,
+		}
+	}
+	return ce
+}
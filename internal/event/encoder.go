@@ -0,0 +1,77 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+)
+
+// Encoder builds the topic and the payload of the events in the configured format.
+// It implements the persistence.OutboxEncoder, so the events can be stored in the outbox.
+// The W3C trace context of the operation is included in the payload, except for FormatID.
+type Encoder struct {
+	format Format
+	source string
+}
+
+// NewEncoder creates an encoder for the given format, source is only used by FormatCloudEvents
+func NewEncoder(format Format, source string) (*Encoder, error) {
+	switch format {
+	case FormatEnvelope, FormatID:
+	case FormatCloudEvents:
+		if source == "" {
+			return nil, fmt.Errorf("source is required for %q event format", format)
+		}
+	default:
+		return nil, fmt.Errorf("unknown event format %q", format)
+	}
+	return &Encoder{
+		format: format,
+		source: source,
+	}, nil
+}
+
+func (e *Encoder) EncodeCreate(ctx context.Context, user *model.User) (string, []byte, error) {
+	envelope := newEnvelope(ctx, topicUserCreated, user.ID, user.Version)
+	envelope.User = userToEvent(user)
+	return e.encode(envelope)
+}
+
+func (e *Encoder) EncodeUpdate(ctx context.Context, prev, user *model.User) (string, []byte, error) {
+	envelope := newEnvelope(ctx, topicUserUpdated, user.ID, user.Version)
+	envelope.User = userToEvent(user)
+	envelope.Previous = userToEvent(prev)
+	envelope.ChangedFields = changedFields(prev, user)
+	return e.encode(envelope)
+}
+
+func (e *Encoder) EncodeDelete(ctx context.Context, userID string, version int64) (string, []byte, error) {
+	return e.encode(newEnvelope(ctx, topicUserDeleted, userID, version))
+}
+
+func (e *Encoder) EncodeSnapshot(ctx context.Context, user *model.User) (string, []byte, error) {
+	envelope := newEnvelope(ctx, topicUserSnapshot, user.ID, user.Version)
+	envelope.User = userToEvent(user)
+	return e.encode(envelope)
+}
+
+// encode uses the envelope type as the topic
+func (e *Encoder) encode(envelope *Envelope) (string, []byte, error) {
+	var payload interface{}
+	switch e.format {
+	case FormatID:
+		payload = envelope.UserID
+	case FormatCloudEvents:
+		payload = envelopeToCloudEvent(envelope, e.source)
+	default:
+		payload = envelope
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("can't marshal event: %s", err)
+	}
+	return envelope.Type, data, nil
+}
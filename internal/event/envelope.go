@@ -0,0 +1,113 @@
+package event
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// EnvelopeVersion is increased on every breaking change of the Envelope
+const EnvelopeVersion = 1
+
+// Envelope is the payload of the events published with FormatEnvelope
+type Envelope struct {
+	Version int `json:"version"`
+	// ID is unique for each event, consumers can use it for deduplication
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Time string `json:"time"`
+
+	UserID string `json:"user_id"`
+	// UserVersion is increased on every change of the user, consumers can use it to discard the outdated events.
+	// A snapshot has the version of the user when it was taken, so it can be older than the last event received.
+	UserVersion int64 `json:"user_version"`
+	// User is the state of the user after the change, it's not provided for the deleted users.
+	// For the snapshots, it's the state of the user when the snapshot was taken.
+	User *User `json:"user,omitempty"`
+	// Previous is the state of the user before the change, it's only provided for the updated users
+	Previous *User `json:"previous,omitempty"`
+	// ChangedFields contains the JSON names of the fields changed by an update.
+	// A password change is notified as "password", although the password itself is never part of the events.
+	ChangedFields []string `json:"changed_fields,omitempty"`
+
+	// TraceParent and TraceState are the W3C trace context of the operation that originated the event, if it was traced,
+	// so consumers can continue the trace.
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
+}
+
+// User is the user model of the events, it never contains the password or its hash
+type User struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Country   string `json:"country"`
+}
+
+func newEnvelope(ctx context.Context, eventType, userID string, userVersion int64) *Envelope {
+	traceContext := propagation.HeaderCarrier(http.Header{})
+	propagation.TraceContext{}.Inject(ctx, traceContext)
+	return &Envelope{
+		Version:     EnvelopeVersion,
+		ID:          uuidv4(),
+		Type:        eventType,
+		Time:        timeNow().UTC().Format(time.RFC3339Nano),
+		UserID:      userID,
+		UserVersion: userVersion,
+		TraceParent: traceContext.Get("traceparent"),
+		TraceState:  traceContext.Get("tracestate"),
+	}
+}
+
+func userToEvent(u *model.User) *User {
+	return &User{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt.Format(time.RFC3339Nano),
+		UpdatedAt: u.UpdatedAt.Format(time.RFC3339Nano),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Name:      u.Name,
+		Email:     u.Email,
+		Country:   u.Country,
+	}
+}
+
+// changedFields compares the users ignoring the UpdatedAt, which changes on every update.
+// Since the previous user doesn't have the password hash, a provided hash means that the password was changed.
+func changedFields(prev, user *model.User) []string {
+	var changed []string
+	for _, field := range []struct {
+		name       string
+		prev, curr string
+	}{
+		{"first_name", prev.FirstName, user.FirstName},
+		{"last_name", prev.LastName, user.LastName},
+		{"name", prev.Name, user.Name},
+		{"email", prev.Email, user.Email},
+		{"country", prev.Country, user.Country},
+	} {
+		if field.prev != field.curr {
+			changed = append(changed, field.name)
+		}
+	}
+	if user.PasswordHash != "" {
+		changed = append(changed, "password")
+	}
+	return changed
+}
+
+var timeNow = func() time.Time {
+	return time.Now()
+}
+
+var uuidv4 = func() string {
+	return uuid.New().String()
+}
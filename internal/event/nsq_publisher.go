@@ -2,21 +2,36 @@ package event
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 
 	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/tracing"
 )
 
 const (
 	topicUserCreated = "user.created"
 	topicUserUpdated = "user.updated"
 	topicUserDeleted = "user.deleted"
+	// topicUserSnapshot is used to publish the current state of the users that didn't change, like when replaying them
+	topicUserSnapshot = "user.snapshot"
 )
 
-// NSQPublisher implements the persistence.CRUDObserver notifying the IDs of the changed entities through NSQ
+// Format defines the payload of the published events
+type Format string
+
+const (
+	// FormatEnvelope publishes the events as an Envelope containing the user state
+	FormatEnvelope Format = "envelope"
+	// FormatID publishes just the JSON-encoded ID of the user, as previous versions of this service did.
+	// It's kept for compatibility with the consumers that weren't migrated yet.
+	FormatID Format = "id"
+	// FormatCloudEvents publishes the envelope as a CloudEvent in structured content mode
+	FormatCloudEvents Format = "cloudevents"
+)
+
+// NSQPublisher implements the persistence.CRUDObserver notifying the changed entities through NSQ
 type NSQPublisher struct {
-	nsq nsqProducer
+	nsq     nsqProducer
+	encoder *Encoder
 }
 
 //go:generate mockery -inpkg -testonly -case underscore -name nsqProducer
@@ -24,28 +39,54 @@ type nsqProducer interface {
 	Publish(string, []byte) error
 }
 
-func NewNSQPublisher(producer nsqProducer) *NSQPublisher {
-	return &NSQPublisher{
-		nsq: producer,
+// NewNSQPublisher creates a publisher for the given format, source is only used by FormatCloudEvents
+func NewNSQPublisher(producer nsqProducer, format Format, source string) (*NSQPublisher, error) {
+	encoder, err := NewEncoder(format, source)
+	if err != nil {
+		return nil, err
 	}
+	return &NSQPublisher{
+		nsq:     producer,
+		encoder: encoder,
+	}, nil
 }
 
 func (n *NSQPublisher) OnCreate(ctx context.Context, user *model.User) error {
-	return n.publish(ctx, topicUserCreated, user.ID)
+	topic, payload, err := n.encoder.EncodeCreate(ctx, user)
+	if err != nil {
+		return err
+	}
+	return n.publish(ctx, topic, payload)
 }
 
-func (n *NSQPublisher) OnUpdate(ctx context.Context, user *model.User) error {
-	return n.publish(ctx, topicUserUpdated, user.ID)
+func (n *NSQPublisher) OnUpdate(ctx context.Context, prev, user *model.User) error {
+	topic, payload, err := n.encoder.EncodeUpdate(ctx, prev, user)
+	if err != nil {
+		return err
+	}
+	return n.publish(ctx, topic, payload)
 }
 
-func (n *NSQPublisher) OnDelete(ctx context.Context, userID string) error {
-	return n.publish(ctx, topicUserDeleted, userID)
+// PublishSnapshot publishes the current state of the user, it's not a CRUDObserver method
+func (n *NSQPublisher) PublishSnapshot(ctx context.Context, user *model.User) error {
+	topic, payload, err := n.encoder.EncodeSnapshot(ctx, user)
+	if err != nil {
+		return err
+	}
+	return n.publish(ctx, topic, payload)
 }
 
-func (n *NSQPublisher) publish(_ context.Context, topic, userID string) error {
-	data, err := json.Marshal(userID)
+func (n *NSQPublisher) OnDelete(ctx context.Context, userID string, version int64) error {
+	topic, payload, err := n.encoder.EncodeDelete(ctx, userID, version)
 	if err != nil {
-		return fmt.Errorf("can't marshal user ID: %s", err)
+		return err
 	}
-	return n.nsq.Publish(topic, data)
+	return n.publish(ctx, topic, payload)
+}
+
+// publish traces the publishing of the event, the payload already contains the trace context of the operation
+func (n *NSQPublisher) publish(ctx context.Context, topic string, payload []byte) (err error) {
+	_, span := tracing.StartPublishSpan(ctx, topic, payload)
+	defer func() { tracing.EndSpan(span, err) }()
+	return n.nsq.Publish(topic, payload)
 }
@@ -3,41 +3,190 @@ package event
 import (
 	"context"
 	"errors"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/a-faceit-candidate/userservice/internal/model"
 	"github.com/go-playground/assert/v2"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const someUserID = "asdf-asdf"
+const (
+	someUserID = "asdf-asdf"
+	someSource = "userservice"
+)
 
 var someUserIDJSON = []byte(`"asdf-asdf"`)
 
 var expectedErr = errors.New("the expected error")
 
+var (
+	mockedNow       = time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	mockedEventID   = "00000000-0000-4000-8000-000000000000"
+	someCreatedAt   = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	someUpdatedAt   = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	somePrevUser    = &model.User{ID: someUserID, CreatedAt: someCreatedAt, UpdatedAt: someCreatedAt, Version: 1, FirstName: "John", LastName: "Doe", Name: "john", Email: "john@faceit.com", Country: "uk"}
+	someUpdatedUser = &model.User{ID: someUserID, CreatedAt: someCreatedAt, UpdatedAt: someUpdatedAt, Version: 2, FirstName: "John", LastName: "Doe", Name: "johnny", Email: "john@faceit.com", Country: "es", PasswordHash: "$argon2id$..."}
+)
+
+// someTracedContext carries a sampled span context, as if the operation was traced
+var someTracedContext = trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+	SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+	TraceFlags: trace.FlagsSampled,
+}))
+
+func TestMain(m *testing.M) {
+	timeNow = func() time.Time { return mockedNow }
+	uuidv4 = func() string { return mockedEventID }
+	os.Exit(m.Run())
+}
+
+func TestNewNSQPublisher(t *testing.T) {
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := NewNSQPublisher(&mockNsqProducer{}, "xml", someSource)
+		require.Error(t, err)
+	})
+
+	t.Run("cloudevents without source", func(t *testing.T) {
+		_, err := NewNSQPublisher(&mockNsqProducer{}, FormatCloudEvents, "")
+		require.Error(t, err)
+	})
+}
+
 func TestNSQPublisher_OnCreate(t *testing.T) {
-	producer := &mockNsqProducer{}
-	producer.On("Publish", topicUserCreated, someUserIDJSON).Return(expectedErr)
+	t.Run("envelope", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, []byte(`{"version":1,"id":"00000000-0000-4000-8000-000000000000","type":"user.created","time":"2020-01-02T03:04:05.000006Z","user_id":"asdf-asdf","user_version":1,"user":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","first_name":"John","last_name":"Doe","name":"john","email":"john@faceit.com","country":"uk"}}`)).Return(expectedErr)
 
-	publisher := NewNSQPublisher(producer)
-	err := publisher.OnCreate(context.Background(), &model.User{ID: someUserID})
-	assert.Equal(t, expectedErr, err)
+		publisher, err := NewNSQPublisher(producer, FormatEnvelope, "")
+		require.NoError(t, err)
+		err = publisher.OnCreate(context.Background(), somePrevUser)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("traced envelope", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, []byte(`{"version":1,"id":"00000000-0000-4000-8000-000000000000","type":"user.created","time":"2020-01-02T03:04:05.000006Z","user_id":"asdf-asdf","user_version":1,"user":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","first_name":"John","last_name":"Doe","name":"john","email":"john@faceit.com","country":"uk"},`+
+			`"traceparent":"00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"}`)).Return(nil)
+
+		publisher, err := NewNSQPublisher(producer, FormatEnvelope, "")
+		require.NoError(t, err)
+		err = publisher.OnCreate(someTracedContext, somePrevUser)
+		require.NoError(t, err)
+	})
+
+	t.Run("cloudevents", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, []byte(`{"specversion":"1.0","id":"00000000-0000-4000-8000-000000000000","source":"userservice","type":"com.faceit.user.created","subject":"asdf-asdf","time":"2020-01-02T03:04:05.000006Z","datacontenttype":"application/json","userversion":1,`+
+			`"data":{"user":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","first_name":"John","last_name":"Doe","name":"john","email":"john@faceit.com","country":"uk"}}}`)).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatCloudEvents, someSource)
+		require.NoError(t, err)
+		err = publisher.OnCreate(context.Background(), somePrevUser)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("id", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, someUserIDJSON).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatID, "")
+		require.NoError(t, err)
+		err = publisher.OnCreate(context.Background(), &model.User{ID: someUserID})
+		assert.Equal(t, expectedErr, err)
+	})
 }
 
 func TestNSQPublisher_OnUpdate(t *testing.T) {
-	producer := &mockNsqProducer{}
-	producer.On("Publish", topicUserUpdated, someUserIDJSON).Return(expectedErr)
+	t.Run("envelope", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserUpdated, []byte(`{"version":1,"id":"00000000-0000-4000-8000-000000000000","type":"user.updated","time":"2020-01-02T03:04:05.000006Z","user_id":"asdf-asdf","user_version":2,`+
+			`"user":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-02T00:00:00Z","first_name":"John","last_name":"Doe","name":"johnny","email":"john@faceit.com","country":"es"},`+
+			`"previous":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","first_name":"John","last_name":"Doe","name":"john","email":"john@faceit.com","country":"uk"},`+
+			`"changed_fields":["name","country","password"]}`)).Return(expectedErr)
 
-	publisher := NewNSQPublisher(producer)
-	err := publisher.OnUpdate(context.Background(), &model.User{ID: someUserID})
-	assert.Equal(t, expectedErr, err)
+		publisher, err := NewNSQPublisher(producer, FormatEnvelope, "")
+		require.NoError(t, err)
+		err = publisher.OnUpdate(context.Background(), somePrevUser, someUpdatedUser)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("cloudevents", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserUpdated, []byte(`{"specversion":"1.0","id":"00000000-0000-4000-8000-000000000000","source":"userservice","type":"com.faceit.user.updated","subject":"asdf-asdf","time":"2020-01-02T03:04:05.000006Z","datacontenttype":"application/json","userversion":2,`+
+			`"data":{"user":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-02T00:00:00Z","first_name":"John","last_name":"Doe","name":"johnny","email":"john@faceit.com","country":"es"},`+
+			`"previous":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","first_name":"John","last_name":"Doe","name":"john","email":"john@faceit.com","country":"uk"},`+
+			`"changed_fields":["name","country","password"]}}`)).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatCloudEvents, someSource)
+		require.NoError(t, err)
+		err = publisher.OnUpdate(context.Background(), somePrevUser, someUpdatedUser)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("id", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserUpdated, someUserIDJSON).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatID, "")
+		require.NoError(t, err)
+		err = publisher.OnUpdate(context.Background(), somePrevUser, someUpdatedUser)
+		assert.Equal(t, expectedErr, err)
+	})
 }
 
 func TestNSQPublisher_OnDelete(t *testing.T) {
+	t.Run("envelope", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserDeleted, []byte(`{"version":1,"id":"00000000-0000-4000-8000-000000000000","type":"user.deleted","time":"2020-01-02T03:04:05.000006Z","user_id":"asdf-asdf","user_version":3}`)).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatEnvelope, "")
+		require.NoError(t, err)
+		err = publisher.OnDelete(context.Background(), someUserID, 3)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("cloudevents", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserDeleted, []byte(`{"specversion":"1.0","id":"00000000-0000-4000-8000-000000000000","source":"userservice","type":"com.faceit.user.deleted","subject":"asdf-asdf","time":"2020-01-02T03:04:05.000006Z","datacontenttype":"application/json","userversion":3}`)).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatCloudEvents, someSource)
+		require.NoError(t, err)
+		err = publisher.OnDelete(context.Background(), someUserID, 3)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("traced", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserDeleted, []byte(`{"specversion":"1.0","id":"00000000-0000-4000-8000-000000000000","source":"userservice","type":"com.faceit.user.deleted","subject":"asdf-asdf","time":"2020-01-02T03:04:05.000006Z","datacontenttype":"application/json","userversion":3,`+
+			`"traceparent":"00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"}`)).Return(nil)
+
+		publisher, err := NewNSQPublisher(producer, FormatCloudEvents, someSource)
+		require.NoError(t, err)
+		err = publisher.OnDelete(someTracedContext, someUserID, 3)
+		require.NoError(t, err)
+	})
+
+	t.Run("id", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserDeleted, someUserIDJSON).Return(expectedErr)
+
+		publisher, err := NewNSQPublisher(producer, FormatID, "")
+		require.NoError(t, err)
+		err = publisher.OnDelete(context.Background(), someUserID, 3)
+		assert.Equal(t, expectedErr, err)
+	})
+}
+
+func TestNSQPublisher_PublishSnapshot(t *testing.T) {
 	producer := &mockNsqProducer{}
-	producer.On("Publish", topicUserDeleted, someUserIDJSON).Return(expectedErr)
+	producer.On("Publish", topicUserSnapshot, []byte(`{"version":1,"id":"00000000-0000-4000-8000-000000000000","type":"user.snapshot","time":"2020-01-02T03:04:05.000006Z","user_id":"asdf-asdf","user_version":1,"user":{"id":"asdf-asdf","created_at":"2020-01-01T00:00:00Z","updated_at":"2020-01-01T00:00:00Z","first_name":"John","last_name":"Doe","name":"john","email":"john@faceit.com","country":"uk"}}`)).Return(expectedErr)
 
-	publisher := NewNSQPublisher(producer)
-	err := publisher.OnDelete(context.Background(), someUserID)
+	publisher, err := NewNSQPublisher(producer, FormatEnvelope, "")
+	require.NoError(t, err)
+	err = publisher.PublishSnapshot(context.Background(), somePrevUser)
 	assert.Equal(t, expectedErr, err)
 }
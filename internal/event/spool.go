@@ -0,0 +1,309 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrSpoolFull is returned when the event can't be published and there's no room left in the spool
+var ErrSpoolFull = errors.New("event spool is full")
+
+// SpoolConfig configures the disk spool of the events that couldn't be published
+type SpoolConfig struct {
+	// Path of the spool file, the spool is disabled if it's empty
+	Path string
+	// RetryInterval is the time between attempts to publish the spooled events
+	RetryInterval time.Duration `default:"1s"`
+	// MaxEvents is the maximum amount of events kept in the spool
+	MaxEvents int `default:"100000"`
+}
+
+var spoolSize = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "userservice_event_spool_size",
+	Help: "Events waiting in the disk spool to be published",
+})
+
+// SpooledProducer publishes the events through the wrapped producer, storing them in a file if they can't be published.
+// Spooled events are published in the same order they were received once the producer works again,
+// meanwhile the new events are spooled too, so they're not published before the previous ones.
+// The file is loaded when the SpooledProducer is created, so the spooled events survive restarts.
+type SpooledProducer struct {
+	producer nsqProducer
+	cfg      SpoolConfig
+
+	// flushing serializes the flushes, so the same events aren't published twice
+	flushing sync.Mutex
+
+	mu      sync.Mutex
+	file    *os.File
+	pending []spooledEvent
+}
+
+// spooledEvent is stored as a JSON line in the spool file
+type spooledEvent struct {
+	Topic string `json:"topic"`
+	Body  []byte `json:"body"`
+}
+
+// NewSpooledProducer loads the events spooled by previous runs from the configured path
+func NewSpooledProducer(producer nsqProducer, cfg SpoolConfig) (*SpooledProducer, error) {
+	pending, err := loadSpool(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SpooledProducer{
+		producer: producer,
+		cfg:      cfg,
+		pending:  pending,
+	}
+	// the file is rewritten, so a truncated last line is removed before appending new events
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+
+	spoolSize.Set(float64(len(pending)))
+	return s, nil
+}
+
+// Publish only fails if the event can't be spooled
+func (s *SpooledProducer) Publish(topic string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		err := s.producer.Publish(topic, body)
+		if err == nil {
+			return nil
+		}
+		log.For(context.Background()).Warningf("Can't publish event to %s, spooling it: %s", topic, err)
+	}
+
+	return s.spool(spooledEvent{Topic: topic, Body: body})
+}
+
+// Size returns the amount of events in the spool
+func (s *SpooledProducer) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Run publishes the spooled events every configured interval until the context is canceled
+func (s *SpooledProducer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		published, err := s.Flush()
+		if err != nil {
+			log.For(ctx).Warningf("Can't publish spooled events, %d published, %d left: %s", published, s.Size(), err)
+		} else if published > 0 {
+			log.For(ctx).Infof("Published %d spooled events", published)
+		}
+	}
+}
+
+// Flush publishes the spooled events in order until one fails, removing the published ones from the spool.
+// The events are published without holding the lock, so Publish isn't blocked meanwhile: it keeps spooling the new events,
+// as the spool isn't empty until the flush is done, and those are published by the next flush.
+// An event can be published twice if the service stops before the spool file is rewritten.
+func (s *SpooledProducer) Flush() (int, error) {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.mu.Lock()
+	batch := s.pending
+	s.mu.Unlock()
+
+	var published int
+	var err error
+	for _, ev := range batch {
+		if err = s.producer.Publish(ev.Topic, ev.Body); err != nil {
+			break
+		}
+		published++
+	}
+
+	if published == 0 {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// events are only appended while flushing, so the published ones are still the first ones
+	s.pending = s.pending[published:]
+	spoolSize.Set(float64(len(s.pending)))
+	if rewriteErr := s.rewrite(); rewriteErr != nil {
+		return published, rewriteErr
+	}
+	return published, err
+}
+
+// Close closes the spool file, the spooled events will be loaded again by the next SpooledProducer
+func (s *SpooledProducer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *SpooledProducer) spool(ev spooledEvent) error {
+	if len(s.pending) >= s.cfg.MaxEvents {
+		return ErrSpoolFull
+	}
+
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("can't marshal spooled event: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("can't write spool file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("can't sync spool file: %w", err)
+	}
+
+	s.pending = append(s.pending, ev)
+	spoolSize.Set(float64(len(s.pending)))
+	return nil
+}
+
+// rewrite replaces the spool file with the pending events, writing them to a temporary file first,
+// so the spool file is never left half-written.
+// The temporary file is opened for appending, so once it's renamed it becomes the spool file, and the previous one
+// is only closed then: if anything fails, the previous file is kept.
+func (s *SpooledProducer) rewrite() error {
+	tmpPath := s.cfg.Path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("can't create spool file: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, ev := range s.pending {
+		if err := enc.Encode(ev); err != nil {
+			tmp.Close()
+			return fmt.Errorf("can't write spool file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("can't write spool file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("can't sync spool file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.cfg.Path); err != nil {
+		tmp.Close()
+		return fmt.Errorf("can't replace spool file: %w", err)
+	}
+
+	prev := s.file
+	s.file = tmp
+	if prev != nil {
+		if err := prev.Close(); err != nil {
+			log.For(context.Background()).Warningf("Can't close previous spool file: %s", err)
+		}
+	}
+	return nil
+}
+
+// loadSpool ignores an invalid last line, which can only be left by a crash while spooling that event,
+// so it was never accepted.
+// An invalid line followed by other ones fails instead, as the spool file is rewritten once loaded,
+// and ignoring it would lose that event for good.
+func loadSpool(path string) ([]spooledEvent, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("can't open spool file: %w", err)
+	}
+	defer file.Close()
+
+	var pending []spooledEvent
+	var invalidLine int
+	var invalidErr error
+	reader := bufio.NewReader(file)
+	for n := 1; ; n++ {
+		line, err := readSpoolLine(reader)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != errSpooledEventTooLong {
+			return nil, fmt.Errorf("can't read spool file: %w", err)
+		}
+		if invalidErr != nil {
+			return nil, fmt.Errorf("invalid spooled event at line %d of %s: %w", invalidLine, path, invalidErr)
+		}
+
+		var ev spooledEvent
+		if err == nil {
+			err = json.Unmarshal(line, &ev)
+		}
+		if err != nil {
+			invalidLine, invalidErr = n, err
+			continue
+		}
+		pending = append(pending, ev)
+	}
+
+	if invalidErr != nil {
+		log.For(context.Background()).Warningf("Ignoring invalid last spooled event after %d valid ones: %s", len(pending), invalidErr)
+	}
+	return pending, nil
+}
+
+// errSpooledEventTooLong is returned by readSpoolLine when the line is longer than maxSpooledEventSize
+var errSpooledEventTooLong = errors.New("spooled event is too long")
+
+// maxSpooledEventSize is the maximum length of a spool file line that is loaded in memory
+var maxSpooledEventSize = 16 * 1024 * 1024
+
+// readSpoolLine returns the next line without its newline, the lines that are too long are discarded,
+// returning errSpooledEventTooLong instead. It returns io.EOF only if there's nothing left to read.
+func readSpoolLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	var read, tooLong bool
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(bytes.TrimSuffix(line, []byte("\n"))) > maxSpooledEventSize {
+				line, tooLong = nil, true
+			}
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && !read:
+			return nil, io.EOF
+		case err != nil && err != io.EOF:
+			return nil, err
+		case tooLong:
+			return nil, errSpooledEventTooLong
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), nil
+	}
+}
@@ -0,0 +1,179 @@
+package event
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpooledProducer(t *testing.T) {
+	spoolConfig := func(t *testing.T) SpoolConfig {
+		dir, err := ioutil.TempDir("", "spool")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		return SpoolConfig{Path: filepath.Join(dir, "events.spool"), MaxEvents: 2}
+	}
+
+	t.Run("publishes directly while producer works", func(t *testing.T) {
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, someUserIDJSON).Return(nil).Once()
+
+		spooled, err := NewSpooledProducer(producer, spoolConfig(t))
+		require.NoError(t, err)
+		defer spooled.Close()
+
+		require.NoError(t, spooled.Publish(topicUserCreated, someUserIDJSON))
+		assert.Equal(t, 0, spooled.Size())
+		producer.AssertExpectations(t)
+	})
+
+	t.Run("spools events in order until they can be published, surviving restarts", func(t *testing.T) {
+		cfg := spoolConfig(t)
+
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, someUserIDJSON).Return(expectedErr).Once()
+
+		spooled, err := NewSpooledProducer(producer, cfg)
+		require.NoError(t, err)
+
+		require.NoError(t, spooled.Publish(topicUserCreated, someUserIDJSON))
+		// not even tried, as it would be published before the spooled one
+		require.NoError(t, spooled.Publish(topicUserDeleted, someUserIDJSON))
+		assert.Equal(t, ErrSpoolFull, spooled.Publish(topicUserDeleted, someUserIDJSON))
+		assert.Equal(t, 2, spooled.Size())
+		require.NoError(t, spooled.Close())
+
+		producer = &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, someUserIDJSON).Return(nil).Once()
+		producer.On("Publish", topicUserDeleted, someUserIDJSON).Return(expectedErr).Once()
+
+		spooled, err = NewSpooledProducer(producer, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, 2, spooled.Size())
+
+		published, err := spooled.Flush()
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, 1, published)
+		assert.Equal(t, 1, spooled.Size())
+		require.NoError(t, spooled.Close())
+
+		producer = &mockNsqProducer{}
+		producer.On("Publish", topicUserDeleted, someUserIDJSON).Return(nil).Once()
+
+		spooled, err = NewSpooledProducer(producer, cfg)
+		require.NoError(t, err)
+		defer spooled.Close()
+		assert.Equal(t, 1, spooled.Size())
+
+		published, err = spooled.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, published)
+		assert.Equal(t, 0, spooled.Size())
+		producer.AssertExpectations(t)
+	})
+
+	t.Run("spools new events while flushing", func(t *testing.T) {
+		cfg := spoolConfig(t)
+		require.NoError(t, ioutil.WriteFile(cfg.Path, []byte(`{"topic":"user.created","body":"ImFzZGYtYXNkZiI="}`+"\n"), 0600))
+
+		publishing := make(chan struct{})
+		unblock := make(chan struct{})
+		producer := &mockNsqProducer{}
+		producer.On("Publish", topicUserCreated, someUserIDJSON).Return(nil).Run(func(mock.Arguments) {
+			close(publishing)
+			<-unblock
+		}).Once()
+
+		spooled, err := NewSpooledProducer(producer, cfg)
+		require.NoError(t, err)
+
+		type flushResult struct {
+			published int
+			err       error
+		}
+		flushed := make(chan flushResult)
+		go func() {
+			published, err := spooled.Flush()
+			flushed <- flushResult{published, err}
+		}()
+
+		<-publishing
+		// not blocked by the flush, and spooled after the event being flushed
+		require.NoError(t, spooled.Publish(topicUserDeleted, someUserIDJSON))
+		assert.Equal(t, 2, spooled.Size())
+
+		close(unblock)
+		res := <-flushed
+		require.NoError(t, res.err)
+		assert.Equal(t, 1, res.published)
+		assert.Equal(t, 1, spooled.Size())
+		require.NoError(t, spooled.Close())
+
+		spooled, err = NewSpooledProducer(&mockNsqProducer{}, cfg)
+		require.NoError(t, err)
+		defer spooled.Close()
+		require.Equal(t, 1, spooled.Size())
+		assert.Equal(t, topicUserDeleted, spooled.pending[0].Topic)
+	})
+
+	t.Run("ignores a truncated last event", func(t *testing.T) {
+		cfg := spoolConfig(t)
+		require.NoError(t, ioutil.WriteFile(cfg.Path, []byte(`{"topic":"user.created","body":"ImFzZGYtYXNkZiI="}`+"\n"+`{"topic":"user.del`), 0600))
+
+		spooled, err := NewSpooledProducer(&mockNsqProducer{}, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, 1, spooled.Size())
+		// spooled after the first one, as the producer isn't tried while there are spooled events
+		require.NoError(t, spooled.Publish(topicUserDeleted, someUserIDJSON))
+		require.NoError(t, spooled.Close())
+
+		spooled, err = NewSpooledProducer(&mockNsqProducer{}, cfg)
+		require.NoError(t, err)
+		defer spooled.Close()
+		assert.Equal(t, 2, spooled.Size())
+	})
+
+	t.Run("fails on an invalid event followed by others, keeping the file", func(t *testing.T) {
+		cfg := spoolConfig(t)
+		content := []byte(`{"topic":"user.created","body":"ImFzZGYtYXNkZiI="}` + "\n" + `{"topic":"user.del` + "\n" + `{"topic":"user.deleted","body":"ImFzZGYtYXNkZiI="}` + "\n")
+		require.NoError(t, ioutil.WriteFile(cfg.Path, content, 0600))
+
+		_, err := NewSpooledProducer(&mockNsqProducer{}, cfg)
+		assert.Error(t, err)
+
+		kept, err := ioutil.ReadFile(cfg.Path)
+		require.NoError(t, err)
+		assert.Equal(t, content, kept)
+	})
+
+	t.Run("oversized events", func(t *testing.T) {
+		defer func(max int) { maxSpooledEventSize = max }(maxSpooledEventSize)
+		// bigger than the reader buffer, so the line is read in several chunks
+		maxSpooledEventSize = 8192
+		oversized := `{"topic":"user.created","body":"` + strings.Repeat("a", 10000) + `"}`
+
+		t.Run("last one is ignored", func(t *testing.T) {
+			cfg := spoolConfig(t)
+			require.NoError(t, ioutil.WriteFile(cfg.Path, []byte(`{"topic":"user.created","body":"ImFzZGYtYXNkZiI="}`+"\n"+oversized+"\n"), 0600))
+
+			spooled, err := NewSpooledProducer(&mockNsqProducer{}, cfg)
+			require.NoError(t, err)
+			defer spooled.Close()
+			assert.Equal(t, 1, spooled.Size())
+		})
+
+		t.Run("followed by others fails", func(t *testing.T) {
+			cfg := spoolConfig(t)
+			require.NoError(t, ioutil.WriteFile(cfg.Path, []byte(oversized+"\n"+`{"topic":"user.created","body":"ImFzZGYtYXNkZiI="}`+"\n"), 0600))
+
+			_, err := NewSpooledProducer(&mockNsqProducer{}, cfg)
+			assert.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,529 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+)
+
+const (
+	// WebhookEventHeader contains the topic of the delivered event, like "user.created"
+	WebhookEventHeader = "X-Webhook-Event"
+	// WebhookDeliveryHeader identifies the delivered event, it's the same for all the attempts of delivering it
+	WebhookDeliveryHeader = "X-Webhook-Delivery"
+	// WebhookTimestampHeader contains the unix timestamp of the attempt, which is part of the signed content
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	// WebhookSignatureHeader contains the hex-encoded HMAC-SHA256 of the timestamp and the payload, prefixed by "sha256="
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// maxWebhookResponseBody is the amount of the response body read, so the connection can be reused
+const maxWebhookResponseBody = 64 << 10
+
+// ErrWebhookQueueFull is returned when an event can't be queued for a webhook
+var ErrWebhookQueueFull = errors.New("webhook queue is full")
+
+// errWebhookDispatcherClosed aborts the retries of the deliveries once the dispatcher is closed
+var errWebhookDispatcherClosed = errors.New("webhook dispatcher is closed")
+
+// ErrWebhookAddressNotAllowed is returned when delivering to a webhook that resolves to a loopback, link-local or private
+// address, unless AllowPrivateURLs is set, so the webhooks can't be used to reach the internal network.
+var ErrWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// WebhookConfig configures the delivery of the events to the registered webhooks
+type WebhookConfig struct {
+	// Enabled exposes the webhooks registration API and delivers the events to them
+	Enabled bool
+	// Timeout is the maximum duration of each attempt of delivering an event
+	Timeout time.Duration `default:"5s"`
+	// MaxAttempts of delivering each event, which are retried with an exponential backoff
+	MaxAttempts int           `default:"5"`
+	MinBackoff  time.Duration `default:"1s"`
+	MaxBackoff  time.Duration `default:"1m"`
+	// DisableAfter is the amount of consecutive events failing all their attempts that disables the webhook
+	DisableAfter int `default:"10"`
+	// QueueSize is the amount of events waiting to be delivered to each webhook, events are dropped when it's full
+	QueueSize int `default:"1000"`
+	// DeliveryRetention is the time the deliveries are kept in the log
+	DeliveryRetention time.Duration `default:"168h"`
+	CleanupInterval   time.Duration `default:"1h"`
+	// CleanupBatchSize is the amount of deliveries deleted per query
+	CleanupBatchSize int `default:"1000"`
+	// DrainTimeout is the maximum time waiting for the queued events to be delivered when the service is stopped
+	DrainTimeout time.Duration `default:"10s"`
+	// RefreshInterval is the time between reloads of the registered webhooks, which notice the changes made through other instances
+	RefreshInterval time.Duration `default:"30s"`
+	// AllowPrivateURLs allows delivering to loopback, link-local and private addresses, which are rejected by default
+	AllowPrivateURLs bool
+}
+
+// WebhookDispatcher implements the persistence.CRUDObserver delivering the events to the registered webhooks.
+// Each webhook has its own queue, so events are delivered to it in order, and a failing webhook doesn't delay the rest.
+// Every attempt is stored in the delivery log, and webhooks failing DisableAfter consecutive events are disabled.
+// The registered webhooks are cached, they're loaded with the first event and reloaded by Refresh.
+type WebhookDispatcher struct {
+	repo    persistence.WebhookRepository
+	encoder *Encoder
+	client  *http.Client
+	cfg     WebhookConfig
+
+	mu       sync.Mutex
+	webhooks []*model.Webhook
+	loaded   bool
+	workers  map[string]*webhookWorker
+	closed   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// webhookWorker delivers the queued events to a webhook
+type webhookWorker struct {
+	id    string
+	queue chan *webhookEvent
+
+	mu      sync.Mutex
+	webhook *model.Webhook
+}
+
+// current provides the last known registration of the webhook, which is updated by the refreshes
+func (w *webhookWorker) current() *model.Webhook {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.webhook
+}
+
+func (w *webhookWorker) update(webhook *model.Webhook) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.webhook = webhook
+}
+
+type webhookEvent struct {
+	deliveryID string
+	topic      string
+	payload    []byte
+}
+
+// NewWebhookDispatcher creates a dispatcher delivering the events encoded by the encoder provided
+func NewWebhookDispatcher(repo persistence.WebhookRepository, encoder *Encoder, cfg WebhookConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repo:    repo,
+		encoder: encoder,
+		client:  newWebhookClient(cfg),
+		cfg:     cfg,
+		workers: make(map[string]*webhookWorker),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (d *WebhookDispatcher) OnCreate(ctx context.Context, user *model.User) error {
+	topic, payload, err := d.encoder.EncodeCreate(ctx, user)
+	if err != nil {
+		return err
+	}
+	return d.dispatch(ctx, topic, payload)
+}
+
+func (d *WebhookDispatcher) OnUpdate(ctx context.Context, prev, user *model.User) error {
+	topic, payload, err := d.encoder.EncodeUpdate(ctx, prev, user)
+	if err != nil {
+		return err
+	}
+	return d.dispatch(ctx, topic, payload)
+}
+
+func (d *WebhookDispatcher) OnDelete(ctx context.Context, userID string, version int64) error {
+	topic, payload, err := d.encoder.EncodeDelete(ctx, userID, version)
+	if err != nil {
+		return err
+	}
+	return d.dispatch(ctx, topic, payload)
+}
+
+// Run deletes the deliveries older than the retention period from the log, and refreshes the registered webhooks
+// every RefreshInterval, until the context is canceled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	cleanup := time.NewTicker(d.cfg.CleanupInterval)
+	defer cleanup.Stop()
+	refresh := time.NewTicker(d.cfg.RefreshInterval)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			d.cleanup(ctx)
+		case <-refresh.C:
+			if err := d.Refresh(ctx); err != nil {
+				log.For(ctx).Errorf("Can't refresh webhooks: %s", err)
+			}
+		}
+	}
+}
+
+// Refresh reloads the registered webhooks, it should be called whenever a webhook is created, deleted or enabled.
+// The running workers deliver the next events using the reloaded registration, and the ones of the webhooks that were
+// deleted or disabled meanwhile are stopped.
+func (d *WebhookDispatcher) Refresh(ctx context.Context) error {
+	webhooks, err := d.repo.ListWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("can't list webhooks: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.webhooks = webhooks
+	d.loaded = true
+
+	active := make(map[string]*model.Webhook, len(webhooks))
+	for _, webhook := range webhooks {
+		if webhook.DisabledAt.IsZero() {
+			active[webhook.ID] = webhook
+		}
+	}
+	for id, w := range d.workers {
+		if webhook, ok := active[id]; ok {
+			w.update(webhook)
+		} else {
+			close(w.queue)
+			delete(d.workers, id)
+		}
+	}
+	return nil
+}
+
+// Close stops accepting events, the queued ones are tried once more without retries.
+// It waits until they're delivered or the context is done.
+func (d *WebhookDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	select {
+	case <-d.closed:
+	default:
+		close(d.closed)
+		for id, w := range d.workers {
+			close(w.queue)
+			delete(d.workers, id)
+		}
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries weren't finished: %w", ctx.Err())
+	}
+}
+
+// dispatch queues the event for each enabled webhook subscribed to its topic, loading the webhooks on the first event.
+func (d *WebhookDispatcher) dispatch(ctx context.Context, topic string, payload []byte) error {
+	d.mu.Lock()
+	loaded := d.loaded
+	d.mu.Unlock()
+	if !loaded && !d.isClosed() {
+		if err := d.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.isClosed() {
+		return errWebhookDispatcherClosed
+	}
+
+	var errs []error
+	for _, webhook := range d.webhooks {
+		if !webhook.DisabledAt.IsZero() || !subscribed(webhook, topic) {
+			continue
+		}
+
+		w, ok := d.workers[webhook.ID]
+		if !ok {
+			w = &webhookWorker{id: webhook.ID, webhook: webhook, queue: make(chan *webhookEvent, d.cfg.QueueSize)}
+			d.workers[webhook.ID] = w
+			d.wg.Add(1)
+			go d.work(w)
+		}
+
+		select {
+		case w.queue <- &webhookEvent{deliveryID: uuidv4(), topic: topic, payload: payload}:
+		default:
+			errs = append(errs, fmt.Errorf("%w: can't queue %s for webhook %s", ErrWebhookQueueFull, topic, webhook.ID))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) isClosed() bool {
+	select {
+	case <-d.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// work delivers the queued events until the queue is closed, discarding them once the webhook is disabled
+func (d *WebhookDispatcher) work(w *webhookWorker) {
+	defer d.wg.Done()
+
+	ctx := log.WithValues(context.Background(), map[string]interface{}{"webhook_id": w.id})
+	failures := w.current().ConsecutiveFailures
+	disabled := false
+	for ev := range w.queue {
+		if disabled {
+			continue
+		}
+
+		err := d.deliver(ctx, w, ev)
+		if err == errWebhookDispatcherClosed {
+			continue
+		}
+		if err == nil {
+			if failures > 0 {
+				failures = 0
+				if err := d.repo.MarkWebhookSucceeded(ctx, w.id); err != nil {
+					log.For(ctx).Errorf("Can't mark webhook as succeeded: %s", err)
+				}
+			}
+			continue
+		}
+
+		failures++
+		log.For(ctx).Warningf("Can't deliver %s to webhook after %d attempts, %d consecutive failures: %s", ev.topic, d.cfg.MaxAttempts, failures, err)
+		disabledAt := timeNow()
+		if err := d.repo.MarkWebhookFailed(ctx, w.id, d.cfg.DisableAfter, disabledAt); err != nil {
+			log.For(ctx).Errorf("Can't mark webhook as failed: %s", err)
+		}
+		if failures >= d.cfg.DisableAfter {
+			log.For(ctx).Errorf("Webhook was disabled after %d consecutive failures", failures)
+			d.stopWorker(w, disabledAt)
+			disabled = true
+		}
+	}
+}
+
+// stopWorker closes the queue of a disabled webhook, so its worker discards the queued events and exits.
+// The cached webhook is disabled too, so no more events are queued for it until it's enabled and refreshed.
+func (d *WebhookDispatcher) stopWorker(w *webhookWorker, disabledAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.workers[w.id] != w {
+		// already stopped by a refresh or by Close
+		return
+	}
+	close(w.queue)
+	delete(d.workers, w.id)
+
+	webhooks := make([]*model.Webhook, len(d.webhooks))
+	for i, webhook := range d.webhooks {
+		if webhook.ID == w.id {
+			disabled := *webhook
+			disabled.DisabledAt = disabledAt
+			webhook = &disabled
+		}
+		webhooks[i] = webhook
+	}
+	d.webhooks = webhooks
+}
+
+// deliver tries to deliver the event MaxAttempts times, returning the error of the last attempt.
+// Each attempt uses the current registration of the webhook, so changes are applied to the retries too.
+// Once the dispatcher is closed, failed attempts aren't retried.
+func (d *WebhookDispatcher) deliver(ctx context.Context, w *webhookWorker, ev *webhookEvent) error {
+	var backoff time.Duration
+	for attempt := 1; ; attempt++ {
+		delivery := d.attempt(w.current(), ev, attempt)
+		if err := d.repo.StoreDelivery(ctx, delivery); err != nil {
+			log.For(ctx).Errorf("Can't store webhook delivery: %s", err)
+		}
+		if delivery.Error == "" {
+			return nil
+		}
+		if attempt >= d.cfg.MaxAttempts {
+			return errors.New(delivery.Error)
+		}
+
+		backoff = d.nextBackoff(backoff)
+		select {
+		case <-time.After(backoff):
+		case <-d.closed:
+			return errWebhookDispatcherClosed
+		}
+	}
+}
+
+// attempt sends the event to the webhook, any non-2xx response is a failure
+func (d *WebhookDispatcher) attempt(webhook *model.Webhook, ev *webhookEvent, attempt int) *model.WebhookDelivery {
+	delivery := &model.WebhookDelivery{
+		WebhookID:  webhook.ID,
+		CreatedAt:  timeNow(),
+		DeliveryID: ev.deliveryID,
+		Topic:      ev.topic,
+		Attempt:    attempt,
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(ev.payload))
+	if err != nil {
+		delivery.Error = fmt.Sprintf("can't build request: %s", err)
+		return delivery
+	}
+	timestamp := strconv.FormatInt(delivery.CreatedAt.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, ev.topic)
+	req.Header.Set(WebhookDeliveryHeader, ev.deliveryID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(webhook.Secret, timestamp, ev.payload))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		delivery.Duration = time.Since(start)
+		delivery.Error = err.Error()
+		return delivery
+	}
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+	_ = resp.Body.Close()
+	delivery.Duration = time.Since(start)
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		delivery.Error = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	}
+	return delivery
+}
+
+func (d *WebhookDispatcher) cleanup(ctx context.Context) {
+	createdBefore := timeNow().Add(-d.cfg.DeliveryRetention)
+	for {
+		deleted, err := d.repo.DeleteDeliveries(ctx, createdBefore, d.cfg.CleanupBatchSize)
+		if err != nil {
+			log.For(ctx).Errorf("Can't delete webhook deliveries: %s", err)
+			return
+		}
+		if deleted < d.cfg.CleanupBatchSize {
+			return
+		}
+	}
+}
+
+func (d *WebhookDispatcher) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return d.cfg.MinBackoff
+	}
+	if backoff *= 2; backoff > d.cfg.MaxBackoff {
+		return d.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// newWebhookClient provides the client delivering the events, which rejects the private addresses unless they're allowed.
+func newWebhookClient(cfg WebhookConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateURLs {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   rejectPrivateAddress,
+		}
+		transport.DialContext = dialer.DialContext
+		// the proxy would connect to the webhook on our behalf, skipping the check
+		transport.Proxy = nil
+	}
+	return &http.Client{Timeout: cfg.Timeout, Transport: transport}
+}
+
+// rejectPrivateAddress is called by the dialer with the resolved address, so hostnames resolving to private addresses
+// and redirects to them are rejected too.
+func rejectPrivateAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || IsPrivateAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// privateNetworks are the unspecified, loopback, link-local, private and carrier-grade NAT networks
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10",
+		"::/128", "::1/128", "fe80::/10", "fc00::/7",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// IsPrivateAddress tells whether the IP is an unspecified, loopback, link-local, private or carrier-grade NAT address,
+// which are not allowed for the webhooks by default.
+// IPv4-mapped IPv6 addresses are checked as the IPv4 address they map to.
+func IsPrivateAddress(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhookPayload provides the hex-encoded HMAC-SHA256 of the timestamp and the payload joined by a dot,
+// receivers should compute it to verify the signature header, and reject the old timestamps to prevent replays.
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(webhook *model.Webhook, topic string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, ev := range webhook.Events {
+		if ev == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package event
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence/persistencemock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	cfg := WebhookConfig{
+		Timeout:      time.Second,
+		MaxAttempts:  2,
+		MinBackoff:   time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+		DisableAfter: 2,
+		QueueSize:    10,
+		// receivers listen on localhost
+		AllowPrivateURLs: true,
+	}
+	encoder, err := NewEncoder(FormatEnvelope, "")
+	require.NoError(t, err)
+
+	// receiver records the requests received, answering with the status code provided
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	receiver := func(t *testing.T, statusCode int) (*httptest.Server, func() []received) {
+		var mu sync.Mutex
+		var requests []received
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err)
+			mu.Lock()
+			requests = append(requests, received{header: r.Header, body: body})
+			mu.Unlock()
+			w.WriteHeader(statusCode)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, func() []received {
+			mu.Lock()
+			defer mu.Unlock()
+			return requests
+		}
+	}
+
+	closeDispatcher := func(t *testing.T, d *WebhookDispatcher) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, d.Close(ctx))
+	}
+
+	t.Run("delivers signed events to the subscribed webhooks", func(t *testing.T) {
+		srv, requests := receiver(t, http.StatusNoContent)
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{
+			{ID: "all", URL: srv.URL, Secret: "s3cr3t"},
+			{ID: "updates", URL: srv.URL, Secret: "other", Events: []string{"user.updated"}},
+			{ID: "disabled", URL: srv.URL, Secret: "other", DisabledAt: mockedNow},
+		}, nil).Once()
+		repo.On("StoreDelivery", mock.Anything, mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+			delivery := args.Get(1).(*model.WebhookDelivery)
+			assert.Equal(t, "all", delivery.WebhookID)
+			assert.Equal(t, "user.created", delivery.Topic)
+			assert.Equal(t, mockedEventID, delivery.DeliveryID)
+			assert.Equal(t, 1, delivery.Attempt)
+			assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+			assert.Empty(t, delivery.Error)
+		})
+
+		d := NewWebhookDispatcher(repo, encoder, cfg)
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+		closeDispatcher(t, d)
+
+		got := requests()
+		require.Len(t, got, 1)
+		_, expectedPayload, err := encoder.EncodeCreate(context.Background(), someUpdatedUser)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(expectedPayload), string(got[0].body))
+
+		timestamp := strconv.FormatInt(mockedNow.Unix(), 10)
+		assert.Equal(t, "user.created", got[0].header.Get(WebhookEventHeader))
+		assert.Equal(t, mockedEventID, got[0].header.Get(WebhookDeliveryHeader))
+		assert.Equal(t, timestamp, got[0].header.Get(WebhookTimestampHeader))
+		assert.Equal(t, "sha256="+SignWebhookPayload("s3cr3t", timestamp, got[0].body), got[0].header.Get(WebhookSignatureHeader))
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("retries and disables the failing webhooks", func(t *testing.T) {
+		srv, requests := receiver(t, http.StatusInternalServerError)
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{
+			{ID: "failing", URL: srv.URL, Secret: "s3cr3t", ConsecutiveFailures: 1},
+		}, nil).Once()
+		repo.On("StoreDelivery", mock.Anything, mock.Anything).Return(nil).Twice().Run(func(args mock.Arguments) {
+			delivery := args.Get(1).(*model.WebhookDelivery)
+			assert.Equal(t, http.StatusInternalServerError, delivery.StatusCode)
+			assert.NotEmpty(t, delivery.Error)
+		})
+		disabled := make(chan struct{})
+		repo.On("MarkWebhookFailed", mock.Anything, "failing", 2, mockedNow).Return(nil).Once().Run(func(mock.Arguments) {
+			close(disabled)
+		})
+
+		d := NewWebhookDispatcher(repo, encoder, cfg)
+		require.NoError(t, d.OnDelete(context.Background(), someUserID, 3))
+
+		select {
+		case <-disabled:
+		case <-time.After(time.Second):
+			t.Fatal("webhook wasn't marked as failed")
+		}
+		closeDispatcher(t, d)
+
+		assert.Len(t, requests(), 2)
+		assert.Empty(t, d.workers)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("recovered webhook is marked as succeeded", func(t *testing.T) {
+		srv, _ := receiver(t, http.StatusOK)
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{
+			{ID: "recovered", URL: srv.URL, Secret: "s3cr3t", ConsecutiveFailures: 1},
+		}, nil).Once()
+		repo.On("StoreDelivery", mock.Anything, mock.Anything).Return(nil).Once()
+		repo.On("MarkWebhookSucceeded", mock.Anything, "recovered").Return(nil).Once()
+
+		d := NewWebhookDispatcher(repo, encoder, cfg)
+		require.NoError(t, d.OnUpdate(context.Background(), somePrevUser, someUpdatedUser))
+		closeDispatcher(t, d)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("stops the workers of the deleted webhooks", func(t *testing.T) {
+		srv, _ := receiver(t, http.StatusOK)
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{{ID: "deleted", URL: srv.URL}}, nil).Once()
+		repo.On("ListWebhooks", mock.Anything).Return(nil, nil).Once()
+		repo.On("StoreDelivery", mock.Anything, mock.Anything).Return(nil).Once()
+
+		d := NewWebhookDispatcher(repo, encoder, cfg)
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+		require.NoError(t, d.Refresh(context.Background()))
+		assert.Empty(t, d.workers)
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+		assert.Empty(t, d.workers)
+		closeDispatcher(t, d)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("webhooks are listed once until refreshed", func(t *testing.T) {
+		first, firstRequests := receiver(t, http.StatusOK)
+		second, secondRequests := receiver(t, http.StatusOK)
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{{ID: "moved", URL: first.URL}}, nil).Once()
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{{ID: "moved", URL: second.URL}}, nil).Once()
+		repo.On("StoreDelivery", mock.Anything, mock.Anything).Return(nil)
+
+		d := NewWebhookDispatcher(repo, encoder, cfg)
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+		assert.Eventually(t, func() bool { return len(firstRequests()) == 2 }, time.Second, time.Millisecond)
+
+		// the running worker delivers to the refreshed url
+		require.NoError(t, d.Refresh(context.Background()))
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+		closeDispatcher(t, d)
+
+		assert.Len(t, firstRequests(), 2)
+		assert.Len(t, secondRequests(), 1)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("private addresses are rejected unless allowed", func(t *testing.T) {
+		srv, requests := receiver(t, http.StatusOK)
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return([]*model.Webhook{{ID: "internal", URL: srv.URL}}, nil).Once()
+		delivered := make(chan *model.WebhookDelivery, 1)
+		repo.On("StoreDelivery", mock.Anything, mock.Anything).Return(nil).Once().Run(func(args mock.Arguments) {
+			delivered <- args.Get(1).(*model.WebhookDelivery)
+		})
+		repo.On("MarkWebhookFailed", mock.Anything, "internal", mock.Anything, mockedNow).Return(nil).Once()
+
+		strictCfg := cfg
+		strictCfg.MaxAttempts = 1
+		strictCfg.AllowPrivateURLs = false
+		d := NewWebhookDispatcher(repo, encoder, strictCfg)
+		require.NoError(t, d.OnCreate(context.Background(), someUpdatedUser))
+
+		select {
+		case delivery := <-delivered:
+			assert.Contains(t, delivery.Error, ErrWebhookAddressNotAllowed.Error())
+		case <-time.After(time.Second):
+			t.Fatal("delivery wasn't attempted")
+		}
+		closeDispatcher(t, d)
+		assert.Empty(t, requests())
+	})
+
+	t.Run("closed dispatcher", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("ListWebhooks", mock.Anything).Return(nil, nil).Once()
+
+		d := NewWebhookDispatcher(repo, encoder, cfg)
+		closeDispatcher(t, d)
+		assert.Equal(t, errWebhookDispatcherClosed, d.OnCreate(context.Background(), someUpdatedUser))
+	})
+}
+
+// privateAddressCases tells whether each address is private
+var privateAddressCases = map[string]bool{
+	"127.0.0.1":              true,
+	"10.1.2.3":               true,
+	"172.16.0.1":             true,
+	"192.168.1.1":            true,
+	"169.254.169.254":        true,
+	"0.0.0.0":                true,
+	"100.64.0.1":             true,
+	"100.127.255.255":        true,
+	"::1":                    true,
+	"fe80::1":                true,
+	"fd00::1":                true,
+	"::ffff:127.0.0.1":       true,
+	"::ffff:10.0.0.1":        true,
+	"::ffff:169.254.169.254": true,
+	"::ffff:100.64.0.1":      true,
+	"8.8.8.8":                false,
+	"172.32.0.1":             false,
+	"100.63.255.255":         false,
+	"100.128.0.1":            false,
+	"::ffff:8.8.8.8":         false,
+	"2001:4860:4860::8888":   false,
+}
+
+func TestIsPrivateAddress(t *testing.T) {
+	for ip, private := range privateAddressCases {
+		t.Run(ip, func(t *testing.T) {
+			assert.Equal(t, private, IsPrivateAddress(net.ParseIP(ip)))
+		})
+	}
+}
+
+func TestRejectPrivateAddress(t *testing.T) {
+	for ip, private := range privateAddressCases {
+		t.Run(ip, func(t *testing.T) {
+			err := rejectPrivateAddress("tcp", net.JoinHostPort(ip, "443"), nil)
+			if private {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// calculated running 'echo -n '1600000000.{"id":"x"}' | openssl dgst -sha256 -hmac secret'
+	expected := "f9a16544f04a2b9406f792aed13977a833ef4c607f3b90cac3f646d6d5403e1b"
+	assert.Equal(t, expected, SignWebhookPayload("secret", "1600000000", []byte(`{"id":"x"}`)))
+}
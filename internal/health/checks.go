@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Ping checks that the database is reachable
+func Ping(db *sql.DB) Check {
+	return db.PingContext
+}
+
+type pinger interface {
+	Ping() error
+}
+
+// PingNSQ checks that the nsqd is reachable, the producer reconnects if needed.
+// The producer doesn't accept a context, so the ping is left running in background when the check times out.
+func PingNSQ(producer pinger) Check {
+	return func(ctx context.Context) error {
+		// buffered, so the ping can finish after the check has timed out
+		done := make(chan error, 1)
+		go func() { done <- producer.Ping() }()
+
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Backlog checks that the amount of pending items returned by the count func doesn't exceed max
+func Backlog(count func(context.Context) (int, error), max int) Check {
+	return func(ctx context.Context) error {
+		n, err := count(ctx)
+		if err != nil {
+			return err
+		}
+		if n > max {
+			return fmt.Errorf("%d pending, more than %d", n, max)
+		}
+		return nil
+	}
+}
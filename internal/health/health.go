@@ -0,0 +1,172 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK = "ok"
+	// StatusDegraded means that only non-critical checks are failing, so the service is still ready
+	StatusDegraded = "degraded"
+	StatusFailing  = "failing"
+	// StatusShuttingDown is reported once the service has started its shutdown
+	StatusShuttingDown = "shutting down"
+)
+
+// ErrTimeout is returned when a check doesn't finish before the configured timeout
+var ErrTimeout = errors.New("check timed out")
+
+// Check verifies a dependency of the service, returning an error if it's not healthy.
+// The context is canceled once the configured timeout is reached.
+type Check func(ctx context.Context) error
+
+// Config configures the Registry
+type Config struct {
+	// Timeout is the maximum duration of each check
+	Timeout time.Duration `default:"1s"`
+	// CacheTTL is the time the report is reused, so the probes don't overload the dependencies
+	CacheTTL time.Duration `default:"2s"`
+	// MaxEventBacklog is the amount of events waiting to be published that degrades the status of the service
+	MaxEventBacklog int `default:"10000"`
+}
+
+// Registry runs the registered checks to determine whether the service is ready to receive traffic.
+// All the checks run concurrently, and their report is cached for the configured TTL,
+// concurrent calls wait for the running checks instead of running them again.
+type Registry struct {
+	cfg          Config
+	shuttingDown int32
+
+	mu       sync.Mutex
+	checks   []registeredCheck
+	report   *Report
+	reportAt time.Time
+}
+
+type registeredCheck struct {
+	name     string
+	critical bool
+	check    Check
+}
+
+// Report is the result of running the checks
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready is true unless a critical check is failing, or the service is shutting down
+func (r *Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Critical bool    `json:"critical"`
+	Latency  float64 `json:"latency_ms"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func NewRegistry(cfg Config) *Registry {
+	return &Registry{
+		cfg: cfg,
+	}
+}
+
+// Register adds a check, the service isn't ready while a critical check is failing,
+// while the non-critical ones only degrade its status.
+func (r *Registry) Register(name string, critical bool, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, registeredCheck{name: name, critical: critical, check: check})
+	r.report = nil
+}
+
+// Shutdown makes the service not ready anymore, without running the checks
+func (r *Registry) Shutdown() {
+	atomic.StoreInt32(&r.shuttingDown, 1)
+}
+
+// ShuttingDown is true once Shutdown was called
+func (r *Registry) ShuttingDown() bool {
+	return atomic.LoadInt32(&r.shuttingDown) == 1
+}
+
+// Check runs the checks, unless the last report is still cached.
+// They don't depend on the context of the caller, so a canceled probe doesn't cache a failing report.
+func (r *Registry) Check() *Report {
+	if r.ShuttingDown() {
+		return &Report{Status: StatusShuttingDown}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.report != nil && timeNow().Sub(r.reportAt) < r.cfg.CacheTTL {
+		return r.report
+	}
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(r.checks))}
+	results := make([]CheckResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func(i int, c registeredCheck) {
+			defer wg.Done()
+			results[i] = r.run(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, c := range r.checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status == StatusOK {
+			continue
+		}
+		if c.critical {
+			report.Status = StatusFailing
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	r.report = report
+	r.reportAt = timeNow()
+	return report
+}
+
+// run runs the check with the configured timeout, it doesn't wait for the checks ignoring the context cancellation
+func (r *Registry) run(c registeredCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	result := CheckResult{
+		Status:   StatusOK,
+		Critical: c.critical,
+		Latency:  float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+var timeNow = func() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mockedNow = time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	timeNow = func() time.Time { return mockedNow }
+	os.Exit(m.Run())
+}
+
+func TestRegistry(t *testing.T) {
+	cfg := Config{Timeout: 50 * time.Millisecond, CacheTTL: time.Second}
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("boom") }
+
+	t.Run("all checks ok", func(t *testing.T) {
+		r := NewRegistry(cfg)
+		r.Register("db", true, ok)
+		r.Register("backlog", false, ok)
+
+		report := r.Check()
+		assert.Equal(t, StatusOK, report.Status)
+		assert.True(t, report.Ready())
+		require.Len(t, report.Checks, 2)
+		assert.Equal(t, StatusOK, report.Checks["db"].Status)
+		assert.True(t, report.Checks["db"].Critical)
+		assert.False(t, report.Checks["backlog"].Critical)
+	})
+
+	t.Run("failing non-critical check degrades the status", func(t *testing.T) {
+		r := NewRegistry(cfg)
+		r.Register("db", true, ok)
+		r.Register("backlog", false, failing)
+
+		report := r.Check()
+		assert.Equal(t, StatusDegraded, report.Status)
+		assert.True(t, report.Ready())
+		assert.Equal(t, StatusFailing, report.Checks["backlog"].Status)
+		assert.Equal(t, "boom", report.Checks["backlog"].Error)
+	})
+
+	t.Run("failing critical check", func(t *testing.T) {
+		r := NewRegistry(cfg)
+		r.Register("db", true, failing)
+		r.Register("backlog", false, failing)
+
+		report := r.Check()
+		assert.Equal(t, StatusFailing, report.Status)
+		assert.False(t, report.Ready())
+	})
+
+	t.Run("check timing out", func(t *testing.T) {
+		r := NewRegistry(cfg)
+		blocked := make(chan struct{})
+		defer close(blocked)
+		r.Register("nsq", true, func(context.Context) error {
+			<-blocked
+			return nil
+		})
+
+		report := r.Check()
+		assert.False(t, report.Ready())
+		assert.Equal(t, ErrTimeout.Error(), report.Checks["nsq"].Error)
+		assert.GreaterOrEqual(t, report.Checks["nsq"].Latency, float64(cfg.Timeout.Milliseconds()))
+	})
+
+	t.Run("report is cached", func(t *testing.T) {
+		defer func(orig func() time.Time) { timeNow = orig }(timeNow)
+		now := mockedNow
+		timeNow = func() time.Time { return now }
+
+		var calls int32
+		r := NewRegistry(cfg)
+		r.Register("db", true, func(context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		})
+
+		r.Check()
+		now = now.Add(cfg.CacheTTL - time.Millisecond)
+		r.Check()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		now = now.Add(time.Millisecond)
+		r.Check()
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		r := NewRegistry(cfg)
+		r.Register("db", true, ok)
+		r.Shutdown()
+
+		report := r.Check()
+		assert.True(t, r.ShuttingDown())
+		assert.Equal(t, StatusShuttingDown, report.Status)
+		assert.False(t, report.Ready())
+	})
+}
+
+type pingerFunc func() error
+
+func (f pingerFunc) Ping() error { return f() }
+
+func TestPingNSQ(t *testing.T) {
+	assert.NoError(t, PingNSQ(pingerFunc(func() error { return nil }))(context.Background()))
+	assert.EqualError(t, PingNSQ(pingerFunc(func() error { return errors.New("boom") }))(context.Background()), "boom")
+
+	t.Run("returns when the context is done", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		blocked := pingerFunc(func() error {
+			<-unblock
+			return nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, PingNSQ(blocked)(ctx))
+	})
+}
+
+func TestBacklog(t *testing.T) {
+	count := func(n int, err error) func(context.Context) (int, error) {
+		return func(context.Context) (int, error) { return n, err }
+	}
+
+	assert.NoError(t, Backlog(count(10, nil), 10)(context.Background()))
+	assert.EqualError(t, Backlog(count(11, nil), 10)(context.Background()), "11 pending, more than 10")
+	assert.EqualError(t, Backlog(count(0, errors.New("boom")), 10)(context.Background()), "boom")
+}
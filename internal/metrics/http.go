@@ -0,0 +1,140 @@
+// Package metrics provides the prometheus metrics of the HTTP server
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// unmatchedRoute labels the requests that don't match any route, so unknown paths don't create new series
+	unmatchedRoute = "unmatched"
+	// otherMethod labels the requests with non-standard methods
+	otherMethod = "OTHER"
+)
+
+var (
+	knownMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodDelete:  true,
+		http.MethodOptions: true,
+	}
+	sizeBuckets = prometheus.ExponentialBuckets(64, 4, 8)
+)
+
+// HTTP records the metrics of the requests handled by gin.
+// They're labelled by the route template instead of the path, by the method and by the status class,
+// so the cardinality is bounded by the amount of routes registered, regardless of the requests received.
+type HTTP struct {
+	inFlight     prometheus.Gauge
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+}
+
+// NewHTTP registers the metrics in the registerer provided, it should only be called once for each registerer
+func NewHTTP(reg prometheus.Registerer) *HTTP {
+	labels := []string{"route", "method", "status"}
+	factory := promauto.With(reg)
+	return &HTTP{
+		inFlight: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "userservice_http_requests_in_flight",
+			Help: "Requests being handled",
+		}),
+		requests: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "userservice_http_requests_total",
+			Help: "Requests handled by route, method and status class",
+		}, labels),
+		duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "userservice_http_request_duration_seconds",
+			Help:    "Duration of the requests by route, method and status class",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		requestSize: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "userservice_http_request_size_bytes",
+			Help:    "Size of the request bodies by route, method and status class",
+			Buckets: sizeBuckets,
+		}, labels),
+		responseSize: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "userservice_http_response_size_bytes",
+			Help:    "Size of the response bodies by route, method and status class",
+			Buckets: sizeBuckets,
+		}, labels),
+	}
+}
+
+// Middleware is the gin middleware recording the metrics, it should be used before the routes are registered.
+// Streamed responses, like the changes stream, are recorded once they're finished.
+func (m *HTTP) Middleware(c *gin.Context) {
+	start := time.Now()
+	m.inFlight.Inc()
+	defer m.inFlight.Dec()
+
+	body := &countingReader{ReadCloser: c.Request.Body}
+	if c.Request.Body != nil {
+		c.Request.Body = body
+	}
+
+	c.Next()
+
+	labels := prometheus.Labels{
+		"route":  route(c),
+		"method": method(c.Request.Method),
+		"status": statusClass(c.Writer.Status()),
+	}
+	m.requests.With(labels).Inc()
+	m.duration.With(labels).Observe(time.Since(start).Seconds())
+	m.requestSize.With(labels).Observe(float64(body.n))
+	responseSize := c.Writer.Size()
+	if responseSize < 0 {
+		responseSize = 0
+	}
+	m.responseSize.With(labels).Observe(float64(responseSize))
+}
+
+// route is the template of the route matched, like /v1/users/:id
+func route(c *gin.Context) string {
+	if r := c.FullPath(); r != "" {
+		return r
+	}
+	return unmatchedRoute
+}
+
+func method(m string) string {
+	if knownMethods[m] {
+		return m
+	}
+	return otherMethod
+}
+
+// statusClass returns 2xx, 4xx, etc.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// countingReader counts the bytes read from the request body,
+// as the content length isn't known for the chunked requests.
+type countingReader struct {
+	io.ReadCloser
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += n
+	return n, err
+}
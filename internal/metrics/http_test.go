@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// newRouter provides a router with a couple of user routes, like the ones of the api package
+	newRouter := func(t *testing.T) (*gin.Engine, *HTTP) {
+		m := NewHTTP(prometheus.NewRegistry())
+		g := gin.New()
+		g.Use(m.Middleware)
+		g.GET("/v1/users/:id", func(c *gin.Context) {
+			if c.Param("id") == "missing" {
+				c.JSON(http.StatusNotFound, gin.H{"message": "not found"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+		})
+		g.PUT("/v1/users/:id", func(c *gin.Context) {
+			body, err := c.GetRawData()
+			require.NoError(t, err)
+			c.Data(http.StatusOK, "application/json", body)
+		})
+		return g, m
+	}
+
+	do := func(g *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("labels by route template, so cardinality is bounded", func(t *testing.T) {
+		g, m := newRouter(t)
+		for i := 0; i < 100; i++ {
+			do(g, http.MethodGet, fmt.Sprintf("/v1/users/%d", i), "")
+			do(g, http.MethodGet, fmt.Sprintf("/unknown/%d", i), "")
+			do(g, fmt.Sprintf("METHOD%d", i), "/v1/users/some-id", "")
+		}
+		do(g, http.MethodGet, "/v1/users/missing", "")
+
+		// GET 2xx, GET 4xx, unmatched GET 4xx, and OTHER method 4xx
+		assert.Equal(t, 4, testutil.CollectAndCount(m.requests))
+		assert.Equal(t, 4, testutil.CollectAndCount(m.duration))
+		assert.Equal(t, float64(100), testutil.ToFloat64(m.requests.WithLabelValues("/v1/users/:id", http.MethodGet, "2xx")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues("/v1/users/:id", http.MethodGet, "4xx")))
+		assert.Equal(t, float64(100), testutil.ToFloat64(m.requests.WithLabelValues(unmatchedRoute, http.MethodGet, "4xx")))
+		assert.Equal(t, float64(100), testutil.ToFloat64(m.requests.WithLabelValues(unmatchedRoute, otherMethod, "4xx")))
+		assert.Equal(t, float64(0), testutil.ToFloat64(m.inFlight))
+	})
+
+	t.Run("records request and response sizes", func(t *testing.T) {
+		g, m := newRouter(t)
+		body := `{"first_name":"John"}`
+		rec := do(g, http.MethodPut, "/v1/users/some-id", body)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		expected := fmt.Sprintf(`
+# HELP userservice_http_request_size_bytes Size of the request bodies by route, method and status class
+# TYPE userservice_http_request_size_bytes histogram
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="64"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="256"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="1024"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="4096"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="16384"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="65536"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="262144"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="1.048576e+06"} 1
+userservice_http_request_size_bytes_bucket{method="PUT",route="/v1/users/:id",status="2xx",le="+Inf"} 1
+userservice_http_request_size_bytes_sum{method="PUT",route="/v1/users/:id",status="2xx"} %d
+userservice_http_request_size_bytes_count{method="PUT",route="/v1/users/:id",status="2xx"} 1
+`, len(body))
+		assert.NoError(t, testutil.CollectAndCompare(m.requestSize, strings.NewReader(expected)))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.responseSize))
+	})
+
+	t.Run("status classes", func(t *testing.T) {
+		for status, class := range map[int]string{
+			http.StatusOK:                  "2xx",
+			http.StatusNoContent:           "2xx",
+			http.StatusNotModified:         "3xx",
+			http.StatusPreconditionFailed:  "4xx",
+			http.StatusServiceUnavailable:  "5xx",
+			0:                              "unknown",
+			http.StatusInternalServerError: "5xx",
+		} {
+			assert.Equal(t, class, statusClass(status), status)
+		}
+	})
+}
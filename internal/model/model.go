@@ -3,9 +3,11 @@ package model
 import "time"
 
 type User struct {
-	ID           string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID        string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Version is increased by the repository on every write of the user, starting from 1
+	Version      int64
 	FirstName    string
 	LastName     string
 	Name         string
@@ -14,4 +16,49 @@ type User struct {
 	PasswordHash string
 	PasswordSalt string
 	Country      string
+	DeletedAt    time.Time
+}
+
+// UserPatch contains the changes to be applied to a User, nil fields are left unchanged.
+// UpdatedAt is not a change but the expected UpdatedAt of the user being patched, a zero value means no expectation.
+type UserPatch struct {
+	UpdatedAt time.Time
+	FirstName *string
+	LastName  *string
+	Name      *string
+	Email     *string
+	Password  *string
+	Country   *string
+}
+
+// Webhook is an HTTP endpoint receiving the user lifecycle events
+type Webhook struct {
+	ID        string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	URL       string
+	// Secret is the key used to sign the payloads delivered with HMAC-SHA256
+	Secret string
+	// Events are the topics of the events delivered, like "user.created", all of them are delivered if it's empty
+	Events []string
+	// ConsecutiveFailures is the amount of deliveries that failed after all their attempts since the last successful one
+	ConsecutiveFailures int
+	// DisabledAt is set when the webhook is disabled after failing too many times, it's zero while it's enabled
+	DisabledAt time.Time
+}
+
+// WebhookDelivery is an attempt of delivering an event to a webhook
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID string
+	CreatedAt time.Time
+	// DeliveryID identifies the event delivered to the webhook, it's the same for all the attempts of delivering it
+	DeliveryID string
+	Topic      string
+	Attempt    int
+	// StatusCode is the HTTP status code of the response, it's zero if no response was received
+	StatusCode int
+	// Error is empty if the delivery succeeded
+	Error    string
+	Duration time.Duration
 }
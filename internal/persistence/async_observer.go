@@ -0,0 +1,231 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrObserverQueueFull is returned when the notification is dropped because the observer's queue is full
+var ErrObserverQueueFull = errors.New("observer queue is full")
+
+// ErrObserverClosed is returned when the observer was already closed
+var ErrObserverClosed = errors.New("observer is closed")
+
+// FullQueuePolicy defines what happens when a notification is sent to an AsyncObserver with its queue full
+type FullQueuePolicy string
+
+const (
+	// FullQueueDrop drops the notification, so the operation isn't delayed
+	FullQueueDrop FullQueuePolicy = "drop"
+	// FullQueueBlock waits until there's room in the queue, or until the operation's context is done or the observer is closed
+	FullQueueBlock FullQueuePolicy = "block"
+)
+
+// AsyncObserverConfig configures the queue and the workers of each AsyncObserver
+type AsyncObserverConfig struct {
+	// QueueSize is the maximum amount of notifications waiting to be sent to each observer
+	QueueSize int `default:"1000"`
+	// Workers is the amount of notifications sent concurrently to each observer.
+	// Notifications are sent in order only if there's a single worker.
+	Workers int `default:"1"`
+	// FullQueuePolicy is either "drop" or "block"
+	FullQueuePolicy FullQueuePolicy `default:"drop"`
+	// DrainTimeout is the maximum time waited for the queued notifications to be sent when closing the observer
+	DrainTimeout time.Duration `default:"10s"`
+}
+
+var (
+	observerQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "userservice_observer_queue_depth",
+		Help: "Notifications waiting in the queue of each asynchronous observer",
+	}, []string{"observer"})
+	observerFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "userservice_observer_failures_total",
+		Help: "Notifications that failed to be sent to each asynchronous observer",
+	}, []string{"observer"})
+	observerDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "userservice_observer_dropped_total",
+		Help: "Notifications dropped because the queue of the asynchronous observer was full",
+	}, []string{"observer"})
+)
+
+// AsyncObserver is a CRUDObserver that queues the notifications and sends them to the wrapped observer in background,
+// so the operations aren't delayed by slow observers.
+// Its methods only fail if the notification can't be queued, the errors of the wrapped observer are logged instead.
+type AsyncObserver struct {
+	name     string
+	observer CRUDObserver
+	cfg      AsyncObserverConfig
+
+	mu     sync.RWMutex
+	closed bool
+	// closing is closed by Close, releasing the notifications blocked on a full queue
+	closing chan struct{}
+	// senders are the notifications being queued, the queue can't be closed until they're done
+	senders sync.WaitGroup
+	queue   chan notification
+	workers sync.WaitGroup
+}
+
+type notification struct {
+	ctx    context.Context
+	op     string
+	notify func(context.Context) error
+}
+
+// NewAsyncObserver starts the workers of the observer, name is used in the logs and metrics
+func NewAsyncObserver(name string, observer CRUDObserver, cfg AsyncObserverConfig) (*AsyncObserver, error) {
+	if cfg.FullQueuePolicy != FullQueueDrop && cfg.FullQueuePolicy != FullQueueBlock {
+		return nil, fmt.Errorf("unknown full queue policy %q", cfg.FullQueuePolicy)
+	}
+	if cfg.Workers < 1 {
+		return nil, fmt.Errorf("at least one worker is needed, got %d", cfg.Workers)
+	}
+
+	o := &AsyncObserver{
+		name:     name,
+		observer: observer,
+		cfg:      cfg,
+		closing:  make(chan struct{}),
+		queue:    make(chan notification, cfg.QueueSize),
+	}
+	o.workers.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go o.work()
+	}
+	return o, nil
+}
+
+func (o *AsyncObserver) OnCreate(ctx context.Context, user *model.User) error {
+	return o.enqueue(ctx, "OnCreate", func(ctx context.Context) error {
+		return o.observer.OnCreate(ctx, user)
+	})
+}
+
+func (o *AsyncObserver) OnUpdate(ctx context.Context, prev, user *model.User) error {
+	return o.enqueue(ctx, "OnUpdate", func(ctx context.Context) error {
+		return o.observer.OnUpdate(ctx, prev, user)
+	})
+}
+
+func (o *AsyncObserver) OnDelete(ctx context.Context, id string, version int64) error {
+	return o.enqueue(ctx, "OnDelete", func(ctx context.Context) error {
+		return o.observer.OnDelete(ctx, id, version)
+	})
+}
+
+// OnSoftDelete is only forwarded if the wrapped observer is a SoftDeleteObserver
+func (o *AsyncObserver) OnSoftDelete(ctx context.Context, id string, version int64) error {
+	sd, ok := o.observer.(SoftDeleteObserver)
+	if !ok {
+		return nil
+	}
+	return o.enqueue(ctx, "OnSoftDelete", func(ctx context.Context) error {
+		return sd.OnSoftDelete(ctx, id, version)
+	})
+}
+
+// OnRestore is only forwarded if the wrapped observer is a SoftDeleteObserver
+func (o *AsyncObserver) OnRestore(ctx context.Context, user *model.User) error {
+	sd, ok := o.observer.(SoftDeleteObserver)
+	if !ok {
+		return nil
+	}
+	return o.enqueue(ctx, "OnRestore", func(ctx context.Context) error {
+		return sd.OnRestore(ctx, user)
+	})
+}
+
+// Close stops accepting notifications and waits until the queued ones are sent or the context is done
+func (o *AsyncObserver) Close(ctx context.Context) error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return ErrObserverClosed
+	}
+	o.closed = true
+	close(o.closing)
+	o.mu.Unlock()
+
+	// no more notifications are queued once closing is closed, so the queue can be closed after the ones being queued
+	o.senders.Wait()
+	close(o.queue)
+
+	drained := make(chan struct{})
+	go func() {
+		o.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d notifications weren't sent to %s: %w", len(o.queue), o.name, ctx.Err())
+	}
+}
+
+// enqueue detaches the notification from the context cancellation, as it's sent after the operation is finished
+// The lock is only held to register the sender, so Close isn't blocked by the notifications waiting for room in the queue.
+func (o *AsyncObserver) enqueue(ctx context.Context, op string, notify func(context.Context) error) error {
+	o.mu.RLock()
+	if o.closed {
+		o.mu.RUnlock()
+		return ErrObserverClosed
+	}
+	o.senders.Add(1)
+	o.mu.RUnlock()
+	defer o.senders.Done()
+
+	n := notification{ctx: detachedContext{ctx}, op: op, notify: notify}
+	observerQueueDepth.WithLabelValues(o.name).Inc()
+	if o.cfg.FullQueuePolicy == FullQueueBlock {
+		select {
+		case o.queue <- n:
+			return nil
+		case <-o.closing:
+			observerQueueDepth.WithLabelValues(o.name).Dec()
+			return ErrObserverClosed
+		case <-ctx.Done():
+			observerQueueDepth.WithLabelValues(o.name).Dec()
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case o.queue <- n:
+		return nil
+	default:
+		observerQueueDepth.WithLabelValues(o.name).Dec()
+		observerDropped.WithLabelValues(o.name).Inc()
+		return ErrObserverQueueFull
+	}
+}
+
+func (o *AsyncObserver) work() {
+	defer o.workers.Done()
+	for n := range o.queue {
+		observerQueueDepth.WithLabelValues(o.name).Dec()
+		if err := n.notify(n.ctx); err != nil {
+			observerFailures.WithLabelValues(o.name).Inc()
+			log.For(n.ctx).Warningf("Can't notify observer %s %s: %s", o.name, n.op, err)
+		}
+	}
+}
+
+// detachedContext keeps the values of the operation context, like the log baggage, but not its cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
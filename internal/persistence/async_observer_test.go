@@ -0,0 +1,157 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAsyncObserver(t *testing.T) {
+	_, err := NewAsyncObserver("test", &MockCRUDObserver{}, AsyncObserverConfig{Workers: 1, FullQueuePolicy: "retry"})
+	assert.Error(t, err)
+
+	_, err = NewAsyncObserver("test", &MockCRUDObserver{}, AsyncObserverConfig{Workers: 0, FullQueuePolicy: FullQueueDrop})
+	assert.Error(t, err)
+}
+
+func TestAsyncObserver(t *testing.T) {
+	cfg := AsyncObserverConfig{QueueSize: 1, Workers: 1, FullQueuePolicy: FullQueueDrop}
+
+	t.Run("notifies in background with a detached context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		observer := &MockCRUDObserver{}
+		observer.On("OnCreate", mock.Anything, someUser).Return(expectedErr).Run(func(args mock.Arguments) {
+			assert.NoError(t, args.Get(0).(context.Context).Err())
+		}).Once()
+
+		async, err := NewAsyncObserver("test", observer, cfg)
+		require.NoError(t, err)
+
+		require.NoError(t, async.OnCreate(ctx, someUser))
+		cancel()
+
+		require.NoError(t, async.Close(context.Background()))
+		observer.AssertExpectations(t)
+	})
+
+	t.Run("forwards soft deletes only to soft delete observers", func(t *testing.T) {
+		observer := newMockSoftDeleteCRUDObserver()
+		observer.sd.On("OnSoftDelete", mock.Anything, someUserID, int64(2)).Return(nil).Once()
+		observer.sd.On("OnRestore", mock.Anything, someUser).Return(nil).Once()
+
+		async, err := NewAsyncObserver("test", observer, cfg)
+		require.NoError(t, err)
+		require.NoError(t, async.OnSoftDelete(context.Background(), someUserID, 2))
+		assert.Eventually(t, func() bool { return len(async.queue) == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, async.OnRestore(context.Background(), someUser))
+		require.NoError(t, async.Close(context.Background()))
+		observer.sd.AssertExpectations(t)
+
+		async, err = NewAsyncObserver("test", &MockCRUDObserver{}, cfg)
+		require.NoError(t, err)
+		require.NoError(t, async.OnSoftDelete(context.Background(), someUserID, 2))
+		assert.Empty(t, async.queue)
+		require.NoError(t, async.Close(context.Background()))
+	})
+
+	t.Run("drops notifications when queue is full", func(t *testing.T) {
+		unblock := make(chan time.Time)
+		observer := &MockCRUDObserver{}
+		observer.On("OnDelete", mock.Anything, someUserID, int64(1)).Return(nil).WaitUntil(unblock)
+
+		async, err := NewAsyncObserver("test", observer, cfg)
+		require.NoError(t, err)
+
+		// first one is taken by the worker, second one waits in the queue
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+		assert.Eventually(t, func() bool { return len(async.queue) == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+
+		assert.Equal(t, ErrObserverQueueFull, async.OnDelete(context.Background(), someUserID, 1))
+
+		close(unblock)
+		require.NoError(t, async.Close(context.Background()))
+		observer.AssertNumberOfCalls(t, "OnDelete", 2)
+	})
+
+	t.Run("blocks until the context is done when queue is full", func(t *testing.T) {
+		unblock := make(chan time.Time)
+		observer := &MockCRUDObserver{}
+		observer.On("OnDelete", mock.Anything, someUserID, int64(1)).Return(nil).WaitUntil(unblock)
+
+		blockingCfg := cfg
+		blockingCfg.FullQueuePolicy = FullQueueBlock
+		async, err := NewAsyncObserver("test", observer, blockingCfg)
+		require.NoError(t, err)
+
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+		assert.Eventually(t, func() bool { return len(async.queue) == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, async.OnDelete(ctx, someUserID, 1))
+
+		close(unblock)
+		require.NoError(t, async.Close(context.Background()))
+	})
+
+	t.Run("close releases the notifications blocked on a full queue", func(t *testing.T) {
+		unblock := make(chan time.Time)
+		observer := &MockCRUDObserver{}
+		observer.On("OnDelete", mock.Anything, someUserID, int64(1)).Return(nil).WaitUntil(unblock)
+
+		blockingCfg := cfg
+		blockingCfg.FullQueuePolicy = FullQueueBlock
+		async, err := NewAsyncObserver("test", observer, blockingCfg)
+		require.NoError(t, err)
+
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+		assert.Eventually(t, func() bool { return len(async.queue) == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+
+		blocked := make(chan error)
+		go func() { blocked <- async.OnDelete(context.Background(), someUserID, 1) }()
+
+		closed := make(chan error)
+		go func() { closed <- async.Close(context.Background()) }()
+
+		select {
+		case err := <-blocked:
+			assert.Equal(t, ErrObserverClosed, err)
+		case <-time.After(time.Second):
+			t.Fatal("blocked notification wasn't released by close")
+		}
+
+		close(unblock)
+		select {
+		case err := <-closed:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("close didn't finish")
+		}
+		observer.AssertNumberOfCalls(t, "OnDelete", 2)
+	})
+
+	t.Run("close times out if the queue can't be drained", func(t *testing.T) {
+		unblock := make(chan time.Time)
+		defer close(unblock)
+		observer := &MockCRUDObserver{}
+		observer.On("OnDelete", mock.Anything, someUserID, int64(1)).Return(nil).WaitUntil(unblock)
+
+		async, err := NewAsyncObserver("test", observer, cfg)
+		require.NoError(t, err)
+		require.NoError(t, async.OnDelete(context.Background(), someUserID, 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Error(t, async.Close(ctx))
+
+		assert.Equal(t, ErrObserverClosed, async.OnDelete(context.Background(), someUserID, 1))
+	})
+}
@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dbOpenConnectionsDesc = prometheus.NewDesc(
+		"userservice_mysql_open_connections",
+		"Established connections to MySQL, both in use and idle",
+		nil, nil,
+	)
+	dbInUseConnectionsDesc = prometheus.NewDesc(
+		"userservice_mysql_in_use_connections",
+		"Connections to MySQL currently in use",
+		nil, nil,
+	)
+	dbIdleConnectionsDesc = prometheus.NewDesc(
+		"userservice_mysql_idle_connections",
+		"Idle connections to MySQL",
+		nil, nil,
+	)
+	dbWaitCountDesc = prometheus.NewDesc(
+		"userservice_mysql_wait_count_total",
+		"Total connections to MySQL waited for, because the pool had reached its maximum",
+		nil, nil,
+	)
+	dbWaitDurationDesc = prometheus.NewDesc(
+		"userservice_mysql_wait_duration_seconds_total",
+		"Total time waited for new connections to MySQL",
+		nil, nil,
+	)
+)
+
+// DBStatsCollector exports the sql.DBStats of the connection pool, read on every scrape.
+// The connections are exported as gauges, and the accumulated waits as counters.
+type DBStatsCollector struct {
+	db *sql.DB
+}
+
+func NewDBStatsCollector(db *sql.DB) *DBStatsCollector {
+	return &DBStatsCollector{
+		db: db,
+	}
+}
+
+func (c *DBStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbOpenConnectionsDesc
+	ch <- dbInUseConnectionsDesc
+	ch <- dbIdleConnectionsDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+}
+
+func (c *DBStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(dbOpenConnectionsDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseConnectionsDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleConnectionsDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,190 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	errorClassNotFound = "not_found"
+	errorClassConflict = "conflict"
+	errorClassOther    = "other"
+)
+
+var (
+	repositoryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "userservice_repository_duration_seconds",
+		Help:    "Duration of the repository calls by method, including the failed ones",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	repositoryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "userservice_repository_errors_total",
+		Help: "Failed repository calls by method and error class: not_found, conflict or other",
+	}, []string{"method", "class"})
+	repositoryRows = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "userservice_repository_rows",
+		Help:    "Users returned by the repository list calls by method",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"method"})
+)
+
+// InstrumentedRepository records the prometheus metrics of the calls to the wrapped repository.
+// Every method is wrapped explicitly, so it should be updated when the Repository interface changes.
+type InstrumentedRepository struct {
+	repo Repository
+}
+
+// NewInstrumentedRepository creates a new InstrumentedRepository
+func NewInstrumentedRepository(repo Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{
+		repo: repo,
+	}
+}
+
+func (r *InstrumentedRepository) Create(ctx context.Context, user *model.User) error {
+	defer observeDuration("Create", time.Now())
+	err := r.repo.Create(ctx, user)
+	countError("Create", err)
+	return err
+}
+
+func (r *InstrumentedRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) (*model.User, error) {
+	defer observeDuration("Update", time.Now())
+	prev, err := r.repo.Update(ctx, user, prevUpdatedAt)
+	countError("Update", err)
+	return prev, err
+}
+
+func (r *InstrumentedRepository) UpdatePasswordHash(ctx context.Context, id, prevHash, newHash string) error {
+	defer observeDuration("UpdatePasswordHash", time.Now())
+	err := r.repo.UpdatePasswordHash(ctx, id, prevHash, newHash)
+	countError("UpdatePasswordHash", err)
+	return err
+}
+
+func (r *InstrumentedRepository) Get(ctx context.Context, id string) (*model.User, error) {
+	defer observeDuration("Get", time.Now())
+	user, err := r.repo.Get(ctx, id)
+	countError("Get", err)
+	return user, err
+}
+
+func (r *InstrumentedRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	defer observeDuration("GetByEmail", time.Now())
+	user, err := r.repo.GetByEmail(ctx, email)
+	countError("GetByEmail", err)
+	return user, err
+}
+
+func (r *InstrumentedRepository) GetCredentials(ctx context.Context, id string) (*model.User, error) {
+	defer observeDuration("GetCredentials", time.Now())
+	user, err := r.repo.GetCredentials(ctx, id)
+	countError("GetCredentials", err)
+	return user, err
+}
+
+func (r *InstrumentedRepository) GetCredentialsByEmail(ctx context.Context, email string) (*model.User, error) {
+	defer observeDuration("GetCredentialsByEmail", time.Now())
+	user, err := r.repo.GetCredentialsByEmail(ctx, email)
+	countError("GetCredentialsByEmail", err)
+	return user, err
+}
+
+func (r *InstrumentedRepository) Delete(ctx context.Context, id string, deletedAt time.Time) (*model.User, error) {
+	defer observeDuration("Delete", time.Now())
+	deleted, err := r.repo.Delete(ctx, id, deletedAt)
+	countError("Delete", err)
+	return deleted, err
+}
+
+func (r *InstrumentedRepository) DeleteVersioned(ctx context.Context, id string, prevUpdatedAt, deletedAt time.Time) (*model.User, error) {
+	defer observeDuration("DeleteVersioned", time.Now())
+	deleted, err := r.repo.DeleteVersioned(ctx, id, prevUpdatedAt, deletedAt)
+	countError("DeleteVersioned", err)
+	return deleted, err
+}
+
+func (r *InstrumentedRepository) Restore(ctx context.Context, id string, restoredAt time.Time) error {
+	defer observeDuration("Restore", time.Now())
+	err := r.repo.Restore(ctx, id, restoredAt)
+	countError("Restore", err)
+	return err
+}
+
+func (r *InstrumentedRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*model.User, error) {
+	defer observeDuration("Purge", time.Now())
+	purged, err := r.repo.Purge(ctx, deletedBefore, limit)
+	countError("Purge", err)
+	return purged, err
+}
+
+func (r *InstrumentedRepository) Erase(ctx context.Context, id string) (*model.User, error) {
+	defer observeDuration("Erase", time.Now())
+	erased, err := r.repo.Erase(ctx, id)
+	countError("Erase", err)
+	return erased, err
+}
+
+func (r *InstrumentedRepository) ListAll(ctx context.Context, includeDeleted bool) ([]*model.User, error) {
+	defer observeDuration("ListAll", time.Now())
+	users, err := r.repo.ListAll(ctx, includeDeleted)
+	countRows("ListAll", users, err)
+	return users, err
+}
+
+func (r *InstrumentedRepository) ListCountry(ctx context.Context, countryCode string, includeDeleted bool) ([]*model.User, error) {
+	defer observeDuration("ListCountry", time.Now())
+	users, err := r.repo.ListCountry(ctx, countryCode, includeDeleted)
+	countRows("ListCountry", users, err)
+	return users, err
+}
+
+func (r *InstrumentedRepository) ListAllAfter(ctx context.Context, afterID string, limit int, includeDeleted bool) ([]*model.User, error) {
+	defer observeDuration("ListAllAfter", time.Now())
+	users, err := r.repo.ListAllAfter(ctx, afterID, limit, includeDeleted)
+	countRows("ListAllAfter", users, err)
+	return users, err
+}
+
+func (r *InstrumentedRepository) ListCountryAfter(ctx context.Context, countryCode, afterID string, limit int, includeDeleted bool) ([]*model.User, error) {
+	defer observeDuration("ListCountryAfter", time.Now())
+	users, err := r.repo.ListCountryAfter(ctx, countryCode, afterID, limit, includeDeleted)
+	countRows("ListCountryAfter", users, err)
+	return users, err
+}
+
+func observeDuration(method string, start time.Time) {
+	repositoryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func countError(method string, err error) {
+	if err != nil {
+		repositoryErrors.WithLabelValues(method, errorClass(err)).Inc()
+	}
+}
+
+// countRows counts the users returned by the list calls, or the error if they failed
+func countRows(method string, users []*model.User, err error) {
+	if err != nil {
+		countError(method, err)
+		return
+	}
+	repositoryRows.WithLabelValues(method).Observe(float64(len(users)))
+}
+
+// errorClass groups the errors documented by the Repository, so the ones caused by the requests can be told apart
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return errorClassNotFound
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrDuplicateEmail), errors.Is(err, ErrDuplicateEmailOfDeletedUser):
+		return errorClassConflict
+	default:
+		return errorClassOther
+	}
+}
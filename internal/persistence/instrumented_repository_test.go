@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedRepository(t *testing.T) {
+	t.Run("counts errors by class", func(t *testing.T) {
+		repository := &MockRepository{}
+		repository.On("Get", mock.Anything, "missing").Return(nil, ErrNotFound)
+		repository.On("Get", mock.Anything, "broken").Return(nil, expectedErr)
+		repository.On("Get", mock.Anything, someUserID).Return(someUser, nil)
+		repository.On("Create", mock.Anything, someUser).Return(fmt.Errorf("wrapped: %w", ErrDuplicateEmail))
+
+		notFound := testutil.ToFloat64(repositoryErrors.WithLabelValues("Get", errorClassNotFound))
+		other := testutil.ToFloat64(repositoryErrors.WithLabelValues("Get", errorClassOther))
+		conflict := testutil.ToFloat64(repositoryErrors.WithLabelValues("Create", errorClassConflict))
+
+		instrumented := NewInstrumentedRepository(repository)
+		_, err := instrumented.Get(context.Background(), "missing")
+		assert.Equal(t, ErrNotFound, err)
+		_, err = instrumented.Get(context.Background(), "broken")
+		assert.Equal(t, expectedErr, err)
+		user, err := instrumented.Get(context.Background(), someUserID)
+		require.NoError(t, err)
+		assert.Equal(t, someUser, user)
+		assert.Error(t, instrumented.Create(context.Background(), someUser))
+
+		assert.Equal(t, notFound+1, testutil.ToFloat64(repositoryErrors.WithLabelValues("Get", errorClassNotFound)))
+		assert.Equal(t, other+1, testutil.ToFloat64(repositoryErrors.WithLabelValues("Get", errorClassOther)))
+		assert.Equal(t, conflict+1, testutil.ToFloat64(repositoryErrors.WithLabelValues("Create", errorClassConflict)))
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("records the rows listed", func(t *testing.T) {
+		repositoryRows.Reset()
+		repository := &MockRepository{}
+		repository.On("ListCountry", mock.Anything, "es", false).Return([]*model.User{someUser, someUser}, nil)
+
+		instrumented := NewInstrumentedRepository(repository)
+		users, err := instrumented.ListCountry(context.Background(), "es", false)
+		require.NoError(t, err)
+		assert.Len(t, users, 2)
+
+		expected := `
+# HELP userservice_repository_rows Users returned by the repository list calls by method
+# TYPE userservice_repository_rows histogram
+userservice_repository_rows_bucket{method="ListCountry",le="1"} 0
+userservice_repository_rows_bucket{method="ListCountry",le="4"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="16"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="64"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="256"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="1024"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="4096"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="16384"} 1
+userservice_repository_rows_bucket{method="ListCountry",le="+Inf"} 1
+userservice_repository_rows_sum{method="ListCountry"} 2
+userservice_repository_rows_count{method="ListCountry"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(repositoryRows, strings.NewReader(expected), "userservice_repository_rows"))
+	})
+}
+
+func TestDBStatsCollector(t *testing.T) {
+	mockedDB, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockedDB.Close()
+
+	assert.Equal(t, 5, testutil.CollectAndCount(NewDBStatsCollector(mockedDB)))
+}
@@ -28,13 +28,13 @@ func (_m *MockCRUDObserver) OnCreate(_a0 context.Context, _a1 *model.User) error
 	return r0
 }
 
-// OnDelete provides a mock function with given fields: _a0, _a1
-func (_m *MockCRUDObserver) OnDelete(_a0 context.Context, _a1 string) error {
-	ret := _m.Called(_a0, _a1)
+// OnDelete provides a mock function with given fields: ctx, id, version
+func (_m *MockCRUDObserver) OnDelete(ctx context.Context, id string, version int64) error {
+	ret := _m.Called(ctx, id, version)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, id, version)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -42,13 +42,13 @@ func (_m *MockCRUDObserver) OnDelete(_a0 context.Context, _a1 string) error {
 	return r0
 }
 
-// OnUpdate provides a mock function with given fields: _a0, _a1
-func (_m *MockCRUDObserver) OnUpdate(_a0 context.Context, _a1 *model.User) error {
-	ret := _m.Called(_a0, _a1)
+// OnUpdate provides a mock function with given fields: ctx, prev, user
+func (_m *MockCRUDObserver) OnUpdate(ctx context.Context, prev *model.User, user *model.User) error {
+	ret := _m.Called(ctx, prev, user)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User, *model.User) error); ok {
+		r0 = rf(ctx, prev, user)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -0,0 +1,105 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package persistence
+
+import (
+	context "context"
+
+	model "github.com/a-faceit-candidate/userservice/internal/model"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockOutboxEncoder is an autogenerated mock type for the OutboxEncoder type
+type MockOutboxEncoder struct {
+	mock.Mock
+}
+
+// EncodeCreate provides a mock function with given fields: ctx, user
+func (_m *MockOutboxEncoder) EncodeCreate(ctx context.Context, user *model.User) (string, []byte, error) {
+	ret := _m.Called(ctx, user)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User) string); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 []byte
+	if rf, ok := ret.Get(1).(func(context.Context, *model.User) []byte); ok {
+		r1 = rf(ctx, user)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *model.User) error); ok {
+		r2 = rf(ctx, user)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// EncodeDelete provides a mock function with given fields: ctx, userID, version
+func (_m *MockOutboxEncoder) EncodeDelete(ctx context.Context, userID string, version int64) (string, []byte, error) {
+	ret := _m.Called(ctx, userID, version)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) string); ok {
+		r0 = rf(ctx, userID, version)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 []byte
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) []byte); ok {
+		r1 = rf(ctx, userID, version)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, int64) error); ok {
+		r2 = rf(ctx, userID, version)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// EncodeUpdate provides a mock function with given fields: ctx, prev, user
+func (_m *MockOutboxEncoder) EncodeUpdate(ctx context.Context, prev *model.User, user *model.User) (string, []byte, error) {
+	ret := _m.Called(ctx, prev, user)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User, *model.User) string); ok {
+		r0 = rf(ctx, prev, user)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 []byte
+	if rf, ok := ret.Get(1).(func(context.Context, *model.User, *model.User) []byte); ok {
+		r1 = rf(ctx, prev, user)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *model.User, *model.User) error); ok {
+		r2 = rf(ctx, prev, user)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
@@ -30,18 +30,73 @@ func (_m *MockRepository) Create(_a0 context.Context, _a1 *model.User) error {
 	return r0
 }
 
-// Delete provides a mock function with given fields: _a0, _a1
-func (_m *MockRepository) Delete(_a0 context.Context, _a1 string) error {
-	ret := _m.Called(_a0, _a1)
+// Delete provides a mock function with given fields: ctx, id, deletedAt
+func (_m *MockRepository) Delete(ctx context.Context, id string, deletedAt time.Time) (*model.User, error) {
+	ret := _m.Called(ctx, id, deletedAt)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(_a0, _a1)
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) *model.User); ok {
+		r0 = rf(ctx, id, deletedAt)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, id, deletedAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteVersioned provides a mock function with given fields: ctx, id, prevUpdatedAt, deletedAt
+func (_m *MockRepository) DeleteVersioned(ctx context.Context, id string, prevUpdatedAt time.Time, deletedAt time.Time) (*model.User, error) {
+	ret := _m.Called(ctx, id, prevUpdatedAt, deletedAt)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, time.Time) *model.User); ok {
+		r0 = rf(ctx, id, prevUpdatedAt, deletedAt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, id, prevUpdatedAt, deletedAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Erase provides a mock function with given fields: ctx, id
+func (_m *MockRepository) Erase(ctx context.Context, id string) (*model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
 // Get provides a mock function with given fields: _a0, _a1
@@ -67,13 +122,82 @@ func (_m *MockRepository) Get(_a0 context.Context, _a1 string) (*model.User, err
 	return r0, r1
 }
 
-// ListAll provides a mock function with given fields: _a0
-func (_m *MockRepository) ListAll(_a0 context.Context) ([]*model.User, error) {
-	ret := _m.Called(_a0)
+// GetByEmail provides a mock function with given fields: ctx, email
+func (_m *MockRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	ret := _m.Called(ctx, email)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCredentials provides a mock function with given fields: ctx, id
+func (_m *MockRepository) GetCredentials(ctx context.Context, id string) (*model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCredentialsByEmail provides a mock function with given fields: ctx, email
+func (_m *MockRepository) GetCredentialsByEmail(ctx context.Context, email string) (*model.User, error) {
+	ret := _m.Called(ctx, email)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAll provides a mock function with given fields: ctx, includeDeleted
+func (_m *MockRepository) ListAll(ctx context.Context, includeDeleted bool) ([]*model.User, error) {
+	ret := _m.Called(ctx, includeDeleted)
 
 	var r0 []*model.User
-	if rf, ok := ret.Get(0).(func(context.Context) []*model.User); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, bool) []*model.User); ok {
+		r0 = rf(ctx, includeDeleted)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*model.User)
@@ -81,8 +205,8 @@ func (_m *MockRepository) ListAll(_a0 context.Context) ([]*model.User, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, bool) error); ok {
+		r1 = rf(ctx, includeDeleted)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -90,13 +214,13 @@ func (_m *MockRepository) ListAll(_a0 context.Context) ([]*model.User, error) {
 	return r0, r1
 }
 
-// ListCountry provides a mock function with given fields: ctx, countryCode
-func (_m *MockRepository) ListCountry(ctx context.Context, countryCode string) ([]*model.User, error) {
-	ret := _m.Called(ctx, countryCode)
+// ListAllAfter provides a mock function with given fields: ctx, afterID, limit, includeDeleted
+func (_m *MockRepository) ListAllAfter(ctx context.Context, afterID string, limit int, includeDeleted bool) ([]*model.User, error) {
+	ret := _m.Called(ctx, afterID, limit, includeDeleted)
 
 	var r0 []*model.User
-	if rf, ok := ret.Get(0).(func(context.Context, string) []*model.User); ok {
-		r0 = rf(ctx, countryCode)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, bool) []*model.User); ok {
+		r0 = rf(ctx, afterID, limit, includeDeleted)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*model.User)
@@ -104,8 +228,8 @@ func (_m *MockRepository) ListCountry(ctx context.Context, countryCode string) (
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, countryCode)
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, bool) error); ok {
+		r1 = rf(ctx, afterID, limit, includeDeleted)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -113,13 +237,119 @@ func (_m *MockRepository) ListCountry(ctx context.Context, countryCode string) (
 	return r0, r1
 }
 
+// ListCountry provides a mock function with given fields: ctx, countryCode, includeDeleted
+func (_m *MockRepository) ListCountry(ctx context.Context, countryCode string, includeDeleted bool) ([]*model.User, error) {
+	ret := _m.Called(ctx, countryCode, includeDeleted)
+
+	var r0 []*model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) []*model.User); ok {
+		r0 = rf(ctx, countryCode, includeDeleted)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool) error); ok {
+		r1 = rf(ctx, countryCode, includeDeleted)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCountryAfter provides a mock function with given fields: ctx, countryCode, afterID, limit, includeDeleted
+func (_m *MockRepository) ListCountryAfter(ctx context.Context, countryCode string, afterID string, limit int, includeDeleted bool) ([]*model.User, error) {
+	ret := _m.Called(ctx, countryCode, afterID, limit, includeDeleted)
+
+	var r0 []*model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, bool) []*model.User); ok {
+		r0 = rf(ctx, countryCode, afterID, limit, includeDeleted)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, bool) error); ok {
+		r1 = rf(ctx, countryCode, afterID, limit, includeDeleted)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Purge provides a mock function with given fields: ctx, deletedBefore, limit
+func (_m *MockRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*model.User, error) {
+	ret := _m.Called(ctx, deletedBefore, limit)
+
+	var r0 []*model.User
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) []*model.User); ok {
+		r0 = rf(ctx, deletedBefore, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, deletedBefore, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Restore provides a mock function with given fields: ctx, id, restoredAt
+func (_m *MockRepository) Restore(ctx context.Context, id string, restoredAt time.Time) error {
+	ret := _m.Called(ctx, id, restoredAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, restoredAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Update provides a mock function with given fields: ctx, user, prevUpdatedAt
-func (_m *MockRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) error {
+func (_m *MockRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) (*model.User, error) {
 	ret := _m.Called(ctx, user, prevUpdatedAt)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.User, time.Time) error); ok {
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User, time.Time) *model.User); ok {
 		r0 = rf(ctx, user, prevUpdatedAt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.User, time.Time) error); ok {
+		r1 = rf(ctx, user, prevUpdatedAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdatePasswordHash provides a mock function with given fields: ctx, id, prevHash, newHash
+func (_m *MockRepository) UpdatePasswordHash(ctx context.Context, id string, prevHash string, newHash string) error {
+	ret := _m.Called(ctx, id, prevHash, newHash)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, id, prevHash, newHash)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -0,0 +1,43 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package persistence
+
+import (
+	context "context"
+
+	model "github.com/a-faceit-candidate/userservice/internal/model"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockSoftDeleteObserver is an autogenerated mock type for the SoftDeleteObserver type
+type MockSoftDeleteObserver struct {
+	mock.Mock
+}
+
+// OnRestore provides a mock function with given fields: ctx, user
+func (_m *MockSoftDeleteObserver) OnRestore(ctx context.Context, user *model.User) error {
+	ret := _m.Called(ctx, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// OnSoftDelete provides a mock function with given fields: ctx, id, version
+func (_m *MockSoftDeleteObserver) OnSoftDelete(ctx context.Context, id string, version int64) error {
+	ret := _m.Called(ctx, id, version)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, id, version)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,141 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const outboxTable = "outbox"
+
+// relayLockName is the name of the lock held by the relay, prefixed by the database name as mysql locks are server-wide
+const relayLockName = "CONCAT(DATABASE(), '.outbox_relay')"
+
+// MysqlOutbox provides the mysql Outbox implementation, the messages are stored by the MysqlRepository
+type MysqlOutbox struct {
+	db *sql.DB
+}
+
+func NewMysqlOutbox(db *sql.DB) *MysqlOutbox {
+	return &MysqlOutbox{
+		db: db,
+	}
+}
+
+// LockRelay uses a mysql named lock, which is held by the connection: if the instance holding it dies,
+// the lock is released as soon as mysql notices the connection is closed.
+func (o *MysqlOutbox) LockRelay(ctx context.Context) (func(), bool, error) {
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("can't get a connection to lock the relay: %w", err)
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK("+relayLockName+", 0)").Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("can't lock the relay: %w", err)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		// the context of the relay may be already canceled, but the lock should be released anyway
+		if _, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK("+relayLockName+")"); err != nil {
+			log.For(ctx).Warningf("Can't unlock the relay: %s", err)
+		}
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+// Pending uses the `by_delivered_at` (delivered_at, id) index
+func (o *MysqlOutbox) Pending(ctx context.Context, limit int) ([]*OutboxMessage, error) {
+	query := fmt.Sprintf("SELECT id, created_at, topic, payload, attempts FROM %s WHERE delivered_at IS NULL ORDER BY id ASC LIMIT %d", outboxTable, limit)
+
+	rows, err := o.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("can't query pending messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*OutboxMessage
+	for rows.Next() {
+		msg := new(OutboxMessage)
+		if err := rows.Scan(&msg.ID, &msg.CreatedAt, &msg.Topic, &msg.Payload, &msg.Attempts); err != nil {
+			return nil, fmt.Errorf("can't scan row: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get all rows: %w", err)
+	}
+	return messages, nil
+}
+
+func (o *MysqlOutbox) MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error {
+	ub := sqlbuilder.NewUpdateBuilder()
+	ub.Update(outboxTable)
+	ub.Set(ub.Assign("delivered_at", deliveredAt))
+	query, args := ub.Where(ub.Equal("id", id)).Build()
+
+	if _, err := o.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't mark message as delivered: %w", err)
+	}
+	return nil
+}
+
+func (o *MysqlOutbox) MarkFailed(ctx context.Context, id int64) error {
+	query := fmt.Sprintf("UPDATE %s SET attempts = attempts + 1 WHERE id = ?", outboxTable)
+
+	if _, err := o.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("can't mark message as failed: %w", err)
+	}
+	return nil
+}
+
+func (o *MysqlOutbox) DeleteDelivered(ctx context.Context, deliveredBefore time.Time, limit int) (int, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE delivered_at < ? ORDER BY delivered_at ASC LIMIT %d", outboxTable, limit)
+
+	res, err := o.db.ExecContext(ctx, query, deliveredBefore)
+	if err != nil {
+		return 0, fmt.Errorf("can't delete delivered messages: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't determine rows affected: %w", err)
+	}
+	return int(affected), nil
+}
+
+// CountPending uses the `by_delivered_at` (delivered_at, id) index
+func (o *MysqlOutbox) CountPending(ctx context.Context) (int, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE delivered_at IS NULL", outboxTable)
+
+	var count int
+	if err := o.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("can't count pending messages: %w", err)
+	}
+	return count, nil
+}
+
+// storeOutboxMessage stores the message in the transaction of the operation that originated it
+func storeOutboxMessage(ctx context.Context, tx *sql.Tx, topic string, payload []byte) error {
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto(outboxTable)
+	ib.Cols("topic", "payload")
+	ib.Values(topic, payload)
+	query, args := ib.Build()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("can't store outbox message: %w", err)
+	}
+	return nil
+}
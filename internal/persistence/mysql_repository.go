@@ -5,95 +5,254 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/a-faceit-candidate/userservice/internal/log"
 	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/tracing"
 	"github.com/go-sql-driver/mysql"
 	"github.com/huandu/go-sqlbuilder"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const table = "user"
 
+var tracer = otel.Tracer("github.com/a-faceit-candidate/userservice/internal/persistence")
+
 const (
 	mysqlDuplicateEntryErrorCode = 1062
 )
 
-// MysqlRepository provides the mysql repository implementation
+// incrVersion is the assignment increasing the version of the user, which should be used on every write
+const incrVersion = "version = version + 1"
+
+// emailUniqueIndex is the name of the unique index on the normalized_email column
+const emailUniqueIndex = "by_normalized_email"
+
+// MysqlRepository provides the mysql repository implementation.
+// It stores the events of the created, updated and purged users in the outbox, in the same transaction as the operation.
 type MysqlRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	outbox OutboxEncoder
 }
 
-func NewMysqlRepository(db *sql.DB) *MysqlRepository {
+// startSpan starts the span of a MysqlRepository method, as a child of the operation span
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "MysqlRepository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mysql"), attribute.String("db.sql.table", table)),
+	)
+}
+
+func NewMysqlRepository(db *sql.DB, outbox OutboxEncoder) *MysqlRepository {
 	return &MysqlRepository{
-		db: db,
+		db:     db,
+		outbox: outbox,
 	}
 }
 
-func (r *MysqlRepository) Create(ctx context.Context, user *model.User) error {
+func (r *MysqlRepository) Create(ctx context.Context, user *model.User) (err error) {
+	ctx, span := startSpan(ctx, "Create")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+		ReadOnly:  false,
+	})
+	if err != nil {
+		return fmt.Errorf("can't start mysql transaction: %w", err)
+	}
+	// rollback just in case we didn't commit
+	defer rollbackTx(ctx, tx)
+
+	user.Version = 1
 	query, args := sqlStruct.InsertInto(table, userToSQL(user)).Build()
-	_, err := r.db.ExecContext(ctx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		if mysqlErr := (&mysql.MySQLError{}); errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntryErrorCode {
-			return ErrConflict
+		if dupErr := duplicateEntryError(err); dupErr == ErrDuplicateEmail {
+			return duplicateEmailError(ctx, tx, user.Email)
+		} else if dupErr != nil {
+			return dupErr
 		}
 		return err
 	}
 
+	topic, payload, err := r.outbox.EncodeCreate(ctx, user)
+	if err != nil {
+		return fmt.Errorf("can't encode created event: %w", err)
+	}
+	if err := storeOutboxMessage(ctx, tx, topic, payload); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit create: %w", err)
+	}
 	return nil
 }
 
-func (r *MysqlRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) error {
+func (r *MysqlRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Update")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelReadCommitted, // READ_COMMITTED is the default one for mysql, although it doesn't make much difference in our usecase
 		ReadOnly:  false,
 	})
 	if err != nil {
-		return fmt.Errorf("can't start mysql transaction: %w", err)
+		return nil, fmt.Errorf("can't start mysql transaction: %w", err)
 	}
 	// rollback just in case we didn't commit
 	defer rollbackTx(ctx, tx)
 
-	query := fmt.Sprintf("SELECT created_at, updated_at FROM %s WHERE id = ? FOR UPDATE", table)
-	args := []interface{}{user.ID}
+	selectBuilder := sqlStruct.SelectFromForTag(table, noPasswordTag)
+	query, args := selectBuilder.Where(selectBuilder.Equal("id", user.ID), selectBuilder.IsNull("deleted_at")).Build()
+	query += " FOR UPDATE"
 
-	var dbCreatedAt, dbUpdatedAt time.Time
-	err = r.db.QueryRowContext(ctx, query, args...).Scan(&dbCreatedAt, &dbUpdatedAt)
+	prev := new(sqlUser)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(sqlStruct.AddrForTag(noPasswordTag, prev)...)
 	if err == sql.ErrNoRows {
-		return ErrNotFound
+		return nil, ErrNotFound
 	} else if err != nil {
-		return fmt.Errorf("can't query for update: %w", err)
+		return nil, fmt.Errorf("can't query for update: %w", err)
 	}
 
-	if dbCreatedAt != user.CreatedAt || dbUpdatedAt != prevUpdatedAt {
-		return ErrConflict
+	if prev.CreatedAt != user.CreatedAt || prev.UpdatedAt != prevUpdatedAt {
+		return nil, ErrConflict
 	}
 
+	user.Version = prev.Version + 1
 	sb := sqlStruct.Update(table, userToSQL(user))
+	if user.PasswordHash != "" && user.PasswordSalt == "" {
+		// omitempty would skip the salt, but we don't want to keep the salt of a previous hash
+		sb.SetMore(sb.Assign("password_salt", ""))
+	}
 	query, args = sb.Where(sb.Equal("id", user.ID)).Build()
 
-	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
-		return fmt.Errorf("can't update: %w", err)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		// we don't update the ID, so the only unique index that can be violated here is the email one
+		if duplicateEntryError(err) == ErrDuplicateEmail {
+			return nil, duplicateEmailError(ctx, tx, user.Email)
+		}
+		return nil, fmt.Errorf("can't update: %w", err)
+	}
+
+	topic, payload, err := r.outbox.EncodeUpdate(ctx, sqlToUser(prev), user)
+	if err != nil {
+		return nil, fmt.Errorf("can't encode updated event: %w", err)
+	}
+	if err := storeOutboxMessage(ctx, tx, topic, payload); err != nil {
+		return nil, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("can't commit update: %w", err)
+		return nil, fmt.Errorf("can't commit update: %w", err)
 	}
+	return sqlToUser(prev), nil
+}
+
+func (r *MysqlRepository) UpdatePasswordHash(ctx context.Context, id, prevHash, newHash string) (err error) {
+	ctx, span := startSpan(ctx, "UpdatePasswordHash")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	ub := sqlbuilder.NewUpdateBuilder()
+	ub.Update(table)
+	ub.Set(
+		ub.Assign("password_hash", newHash),
+		ub.Assign("password_salt", ""),
+		incrVersion,
+	)
+	query, args := ub.Where(ub.Equal("id", id), ub.Equal("password_hash", prevHash), ub.IsNull("deleted_at")).Build()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't update password hash: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't determine rows affected: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrConflict
+	}
+
 	return nil
 }
 
+// duplicateEntryError maps the mysql duplicate entry error to ErrDuplicateEmail if the email unique index was violated,
+// or to ErrConflict otherwise, since the primary key is the only other unique index.
+// It returns nil if err is not a duplicate entry error.
+func duplicateEntryError(err error) error {
+	mysqlErr := &mysql.MySQLError{}
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlDuplicateEntryErrorCode {
+		return nil
+	}
+	if strings.Contains(mysqlErr.Message, emailUniqueIndex) {
+		return ErrDuplicateEmail
+	}
+	return ErrConflict
+}
+
+// duplicateEmailError checks whether the user already having the email is a deleted one, which still holds it until
+// it's purged, returning ErrDuplicateEmailOfDeletedUser in that case, or ErrDuplicateEmail otherwise.
+func duplicateEmailError(ctx context.Context, tx *sql.Tx, email string) error {
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select("id").From(table)
+	query, args := sb.Where(sb.Equal("normalized_email", normalizeEmail(email)), sb.IsNotNull("deleted_at")).Build()
+
+	var id string
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateEmail
+	} else if err != nil {
+		return fmt.Errorf("can't check whether duplicate email belongs to a deleted user: %w", err)
+	}
+	return ErrDuplicateEmailOfDeletedUser
+}
+
 func rollbackTx(ctx context.Context, tx *sql.Tx) {
 	if err := tx.Rollback(); err != sql.ErrTxDone && err != nil {
 		log.For(ctx).Warningf("Couldn't rollback transaction: %s", err)
 	}
 }
 
-func (r *MysqlRepository) Get(ctx context.Context, id string) (*model.User, error) {
-	sb := sqlStruct.SelectFrom(table)
-	query, args := sb.Where(sb.Equal("id", id)).Build()
+func (r *MysqlRepository) Get(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Get")
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.get(ctx, noPasswordTag, "id", id)
+}
+
+// GetByEmail uses the unique index on the normalized email
+func (r *MysqlRepository) GetByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "GetByEmail")
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.get(ctx, noPasswordTag, "normalized_email", normalizeEmail(email))
+}
+
+func (r *MysqlRepository) GetCredentials(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "GetCredentials")
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.get(ctx, allFieldsTag, "id", id)
+}
+
+func (r *MysqlRepository) GetCredentialsByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "GetCredentialsByEmail")
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.get(ctx, allFieldsTag, "normalized_email", normalizeEmail(email))
+}
+
+// get retrieves the user with the given value on a unique column, selecting only the fields with the given tag
+func (r *MysqlRepository) get(ctx context.Context, tag, column string, value interface{}) (*model.User, error) {
+	sb := sqlStruct.SelectFromForTag(table, tag)
+	query, args := sb.Where(sb.Equal(column, value), sb.IsNull("deleted_at")).Build()
 
 	u := new(sqlUser)
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(sqlStruct.Addr(u)...)
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(sqlStruct.AddrForTag(tag, u)...)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	} else if err != nil {
@@ -103,14 +262,115 @@ func (r *MysqlRepository) Get(ctx context.Context, id string) (*model.User, erro
 	return sqlToUser(u), nil
 }
 
-func (r *MysqlRepository) Delete(ctx context.Context, id string) error {
-	sb := sqlStruct.DeleteFrom(table)
-	query, args := sb.Where(sb.Equal("id", id)).Build()
+// Delete locks the user to know the version of the deletion, like Erase does
+func (r *MysqlRepository) Delete(ctx context.Context, id string, deletedAt time.Time) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Delete")
+	defer func() { tracing.EndSpan(span, err) }()
 
-	res, err := r.db.ExecContext(ctx, query, args...)
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+		ReadOnly:  false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't start mysql transaction: %w", err)
+	}
+	// rollback just in case we didn't commit
+	defer rollbackTx(ctx, tx)
+
+	query := fmt.Sprintf("SELECT version FROM %s WHERE id = ? AND deleted_at IS NULL FOR UPDATE", table)
+
+	deleted := &model.User{ID: id}
+	err = tx.QueryRowContext(ctx, query, id).Scan(&deleted.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("can't query for delete: %w", err)
+	}
+	deleted.Version++
+
+	if err := markDeleted(ctx, tx, id, deletedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit delete: %w", err)
+	}
+	return deleted, nil
+}
+
+func (r *MysqlRepository) DeleteVersioned(ctx context.Context, id string, prevUpdatedAt, deletedAt time.Time) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "DeleteVersioned")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+		ReadOnly:  false,
+	})
 	if err != nil {
+		return nil, fmt.Errorf("can't start mysql transaction: %w", err)
+	}
+	// rollback just in case we didn't commit
+	defer rollbackTx(ctx, tx)
+
+	query := fmt.Sprintf("SELECT updated_at, version FROM %s WHERE id = ? AND deleted_at IS NULL FOR UPDATE", table)
+
+	var dbUpdatedAt time.Time
+	deleted := &model.User{ID: id}
+	err = tx.QueryRowContext(ctx, query, id).Scan(&dbUpdatedAt, &deleted.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("can't query for delete: %w", err)
+	}
+
+	if !dbUpdatedAt.Equal(prevUpdatedAt) {
+		return nil, ErrConflict
+	}
+	deleted.Version++
+
+	if err := markDeleted(ctx, tx, id, deletedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit delete: %w", err)
+	}
+	return deleted, nil
+}
+
+// markDeleted sets the DeletedAt of the user, which should be already locked by the transaction
+func markDeleted(ctx context.Context, tx *sql.Tx, id string, deletedAt time.Time) error {
+	ub := sqlbuilder.NewUpdateBuilder()
+	ub.Update(table)
+	ub.Set(
+		ub.Assign("deleted_at", deletedAt),
+		ub.Assign("updated_at", deletedAt),
+		incrVersion,
+	)
+	query, args := ub.Where(ub.Equal("id", id)).Build()
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("can't delete: %w", err)
 	}
+	return nil
+}
+
+func (r *MysqlRepository) Restore(ctx context.Context, id string, restoredAt time.Time) (err error) {
+	ctx, span := startSpan(ctx, "Restore")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	ub := sqlbuilder.NewUpdateBuilder()
+	ub.Update(table)
+	ub.Set(
+		ub.Assign("deleted_at", nil),
+		ub.Assign("updated_at", restoredAt),
+		incrVersion,
+	)
+	query, args := ub.Where(ub.Equal("id", id), ub.IsNotNull("deleted_at")).Build()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't restore: %w", err)
+	}
 
 	affected, err := res.RowsAffected()
 	if err != nil {
@@ -124,19 +384,175 @@ func (r *MysqlRepository) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (r *MysqlRepository) ListAll(ctx context.Context) ([]*model.User, error) {
-	sb := sqlStruct.SelectFromForTag(table, "nopassword")
+// Purge selects the users to purge locking them, so the ones restored meanwhile aren't deleted.
+// The deleted events are stored for the purged users, since the deleted ones can still be restored.
+func (r *MysqlRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "Purge")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+		ReadOnly:  false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't start mysql transaction: %w", err)
+	}
+	// rollback just in case we didn't commit
+	defer rollbackTx(ctx, tx)
+
+	query := fmt.Sprintf("SELECT id, version FROM %s WHERE deleted_at < ? ORDER BY deleted_at ASC LIMIT %d FOR UPDATE", table, limit)
+
+	rows, err := tx.QueryContext(ctx, query, deletedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("can't query users to purge: %w", err)
+	}
+	var purged []*model.User
+	var ids []interface{}
+	for rows.Next() {
+		u := new(model.User)
+		if err := rows.Scan(&u.ID, &u.Version); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("can't scan row: %w", err)
+		}
+		// purging is a write too, although the row is gone
+		u.Version++
+		purged = append(purged, u)
+		ids = append(ids, u.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get all rows: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	db := sqlStruct.DeleteFrom(table)
+	query, args := db.Where(db.In("id", ids...)).Build()
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("can't purge: %w", err)
+	}
+
+	for _, u := range purged {
+		topic, payload, err := r.outbox.EncodeDelete(ctx, u.ID, u.Version)
+		if err != nil {
+			return nil, fmt.Errorf("can't encode deleted event: %w", err)
+		}
+		if err := storeOutboxMessage(ctx, tx, topic, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit purge: %w", err)
+	}
+	return purged, nil
+}
+
+// Erase locks the user to know the version of the erasure, storing the deleted event like Purge does
+func (r *MysqlRepository) Erase(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Erase")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelReadCommitted,
+		ReadOnly:  false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't start mysql transaction: %w", err)
+	}
+	// rollback just in case we didn't commit
+	defer rollbackTx(ctx, tx)
+
+	query := fmt.Sprintf("SELECT version FROM %s WHERE id = ? FOR UPDATE", table)
+
+	erased := &model.User{ID: id}
+	err = tx.QueryRowContext(ctx, query, id).Scan(&erased.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("can't query for erase: %w", err)
+	}
+	erased.Version++
+
+	db := sqlStruct.DeleteFrom(table)
+	query, args := db.Where(db.Equal("id", id)).Build()
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("can't erase: %w", err)
+	}
+
+	topic, payload, err := r.outbox.EncodeDelete(ctx, erased.ID, erased.Version)
+	if err != nil {
+		return nil, fmt.Errorf("can't encode deleted event: %w", err)
+	}
+	if err := storeOutboxMessage(ctx, tx, topic, payload); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit erase: %w", err)
+	}
+	return erased, nil
+}
+
+func (r *MysqlRepository) ListAll(ctx context.Context, includeDeleted bool) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "ListAll")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	sb := sqlStruct.SelectFromForTag(table, noPasswordTag)
+	sb = excludeDeleted(sb, includeDeleted)
 	sb = sb.OrderBy("id").Asc()
 	return r.list(ctx, sb)
 }
 
-func (r *MysqlRepository) ListCountry(ctx context.Context, countryCode string) ([]*model.User, error) {
-	sb := sqlStruct.SelectFromForTag(table, "nopassword")
+func (r *MysqlRepository) ListCountry(ctx context.Context, countryCode string, includeDeleted bool) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "ListCountry")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	sb := sqlStruct.SelectFromForTag(table, noPasswordTag)
 	sb = sb.Where(sb.Equal("country", countryCode))
+	sb = excludeDeleted(sb, includeDeleted)
 	sb = sb.OrderBy("id").Asc()
 	return r.list(ctx, sb)
 }
 
+// ListAllAfter performs a keyset pagination query on the primary key
+func (r *MysqlRepository) ListAllAfter(ctx context.Context, afterID string, limit int, includeDeleted bool) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "ListAllAfter")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	sb := sqlStruct.SelectFromForTag(table, noPasswordTag)
+	if afterID != "" {
+		sb = sb.Where(sb.GreaterThan("id", afterID))
+	}
+	sb = excludeDeleted(sb, includeDeleted)
+	sb = sb.OrderBy("id").Asc().Limit(limit)
+	return r.list(ctx, sb)
+}
+
+// ListCountryAfter performs a keyset pagination query on the `by_country` (country, id) index
+func (r *MysqlRepository) ListCountryAfter(ctx context.Context, countryCode, afterID string, limit int, includeDeleted bool) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "ListCountryAfter")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	sb := sqlStruct.SelectFromForTag(table, noPasswordTag)
+	sb = sb.Where(sb.Equal("country", countryCode))
+	if afterID != "" {
+		sb = sb.Where(sb.GreaterThan("id", afterID))
+	}
+	sb = excludeDeleted(sb, includeDeleted)
+	sb = sb.OrderBy("id").Asc().Limit(limit)
+	return r.list(ctx, sb)
+}
+
+func excludeDeleted(sb *sqlbuilder.SelectBuilder, includeDeleted bool) *sqlbuilder.SelectBuilder {
+	if includeDeleted {
+		return sb
+	}
+	return sb.Where(sb.IsNull("deleted_at"))
+}
+
 func (r *MysqlRepository) list(ctx context.Context, builder *sqlbuilder.SelectBuilder) ([]*model.User, error) {
 	query, args := builder.Build()
 
@@ -147,7 +563,7 @@ func (r *MysqlRepository) list(ctx context.Context, builder *sqlbuilder.SelectBu
 	defer rows.Close()
 
 	u := new(sqlUser)
-	addrs := sqlStruct.Addr(u)
+	addrs := sqlStruct.AddrForTag(noPasswordTag, u)
 	var users []*model.User
 	for rows.Next() {
 		if err := rows.Scan(addrs...); err != nil {
@@ -164,31 +580,46 @@ func (r *MysqlRepository) list(ctx context.Context, builder *sqlbuilder.SelectBu
 
 var sqlStruct = sqlbuilder.NewStruct(new(sqlUser))
 
+const (
+	// noPasswordTag selects all the fields except the password hash and salt, which should only be read when needed
+	noPasswordTag = "nopassword"
+	// allFieldsTag is the empty tag, which selects all the fields of the struct
+	allFieldsTag = ""
+)
+
+// sqlUser is the user stored in mysql.
+// DeletedAt is omitted when empty, so updating a user never restores it if it was deleted meanwhile.
 type sqlUser struct {
-	ID           string    `db:"id"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
-	FirstName    string    `db:"first_name"`
-	LastName     string    `db:"last_name"`
-	Name         string    `db:"name"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash" fieldopt:"omitempty"`
-	PasswordSalt string    `db:"password_salt" fieldopt:"omitempty"`
-	Country      string    `db:"country"`
+	ID              string     `db:"id" fieldtag:"nopassword"`
+	CreatedAt       time.Time  `db:"created_at" fieldtag:"nopassword"`
+	UpdatedAt       time.Time  `db:"updated_at" fieldtag:"nopassword"`
+	Version         int64      `db:"version" fieldtag:"nopassword"`
+	FirstName       string     `db:"first_name" fieldtag:"nopassword"`
+	LastName        string     `db:"last_name" fieldtag:"nopassword"`
+	Name            string     `db:"name" fieldtag:"nopassword"`
+	Email           string     `db:"email" fieldtag:"nopassword"`
+	NormalizedEmail string     `db:"normalized_email" fieldtag:"nopassword"`
+	PasswordHash    string     `db:"password_hash" fieldopt:"omitempty"`
+	PasswordSalt    string     `db:"password_salt" fieldopt:"omitempty"`
+	Country         string     `db:"country" fieldtag:"nopassword"`
+	DeletedAt       *time.Time `db:"deleted_at" fieldtag:"nopassword" fieldopt:"omitempty"`
 }
 
 func userToSQL(u *model.User) *sqlUser {
 	return &sqlUser{
-		ID:           u.ID,
-		CreatedAt:    u.CreatedAt,
-		UpdatedAt:    u.UpdatedAt,
-		FirstName:    u.FirstName,
-		LastName:     u.LastName,
-		Name:         u.Name,
-		Email:        u.Email,
-		Country:      u.Country,
-		PasswordHash: u.PasswordHash,
-		PasswordSalt: u.PasswordSalt,
+		ID:              u.ID,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		Version:         u.Version,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		Name:            u.Name,
+		Email:           u.Email,
+		NormalizedEmail: normalizeEmail(u.Email),
+		Country:         u.Country,
+		PasswordHash:    u.PasswordHash,
+		PasswordSalt:    u.PasswordSalt,
+		DeletedAt:       timeOrNil(u.DeletedAt),
 	}
 }
 
@@ -197,6 +628,7 @@ func sqlToUser(sq *sqlUser) *model.User {
 		ID:           sq.ID,
 		CreatedAt:    sq.CreatedAt,
 		UpdatedAt:    sq.UpdatedAt,
+		Version:      sq.Version,
 		FirstName:    sq.FirstName,
 		LastName:     sq.LastName,
 		Name:         sq.Name,
@@ -204,5 +636,25 @@ func sqlToUser(sq *sqlUser) *model.User {
 		Country:      sq.Country,
 		PasswordHash: sq.PasswordHash,
 		PasswordSalt: sq.PasswordSalt,
+		DeletedAt:    timeOrZero(sq.DeletedAt),
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
 	}
+	return *t
+}
+
+// normalizeEmail provides the value used to check email uniqueness
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -2,12 +2,14 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/a-faceit-candidate/userservice/internal/model"
 	"github.com/go-playground/assert/v2"
 	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,13 +28,69 @@ func TestMysqlRepository_Create(t *testing.T) {
 		require.NoError(t, err)
 		defer mockedDB.Close()
 
+		mysqlMock.ExpectBegin()
 		mysqlMock.ExpectExec("INSERT INTO user .*").WithArgs().
 			// error code is defined here: https://dev.mysql.com/doc/refman/5.7/en/server-error-reference.html#error_er_dup_entry
 			// we intentionally not use the constant we have
 			WillReturnError(&mysql.MySQLError{Number: 1062})
+		mysqlMock.ExpectRollback()
 
-		repo := NewMysqlRepository(mockedDB)
+		repo := NewMysqlRepository(mockedDB, &MockOutboxEncoder{})
 		err = repo.Create(context.Background(), &model.User{ID: "asdf"})
 		assert.Equal(t, ErrConflict, err)
 	})
+
+	t.Run("duplicated email", func(t *testing.T) {
+		mockedDB, mysqlMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer mockedDB.Close()
+
+		mysqlMock.ExpectBegin()
+		mysqlMock.ExpectExec("INSERT INTO user .*").WithArgs().
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'foo@bar.com' for key 'by_normalized_email'"})
+		mysqlMock.ExpectQuery("SELECT id FROM user .*").WithArgs("foo@bar.com").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mysqlMock.ExpectRollback()
+
+		repo := NewMysqlRepository(mockedDB, &MockOutboxEncoder{})
+		err = repo.Create(context.Background(), &model.User{ID: "asdf", Email: "Foo@bar.com"})
+		assert.Equal(t, ErrDuplicateEmail, err)
+	})
+
+	t.Run("duplicated email of deleted user", func(t *testing.T) {
+		mockedDB, mysqlMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer mockedDB.Close()
+
+		mysqlMock.ExpectBegin()
+		mysqlMock.ExpectExec("INSERT INTO user .*").WithArgs().
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'foo@bar.com' for key 'by_normalized_email'"})
+		mysqlMock.ExpectQuery("SELECT id FROM user .*").WithArgs("foo@bar.com").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("deleted"))
+		mysqlMock.ExpectRollback()
+
+		repo := NewMysqlRepository(mockedDB, &MockOutboxEncoder{})
+		err = repo.Create(context.Background(), &model.User{ID: "asdf", Email: "Foo@bar.com"})
+		assert.Equal(t, ErrDuplicateEmailOfDeletedUser, err)
+		require.NoError(t, mysqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("event can't be stored in the outbox", func(t *testing.T) {
+		mockedDB, mysqlMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer mockedDB.Close()
+
+		user := &model.User{ID: "asdf"}
+		encoder := &MockOutboxEncoder{}
+		encoder.On("EncodeCreate", mock.Anything, user).Return("user.created", []byte(`"asdf"`), nil)
+
+		mysqlMock.ExpectBegin()
+		mysqlMock.ExpectExec("INSERT INTO user .*").WillReturnResult(sqlmock.NewResult(0, 1))
+		mysqlMock.ExpectExec("INSERT INTO outbox .*").WithArgs("user.created", []byte(`"asdf"`)).WillReturnError(errors.New("mysql is gone"))
+		// user isn't created if its event can't be stored
+		mysqlMock.ExpectRollback()
+
+		repo := NewMysqlRepository(mockedDB, encoder)
+		err = repo.Create(context.Background(), user)
+		require.Error(t, err)
+		require.NoError(t, mysqlMock.ExpectationsWereMet())
+	})
 }
@@ -0,0 +1,234 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+const (
+	webhookTable         = "webhook"
+	webhookDeliveryTable = "webhook_delivery"
+)
+
+const webhookColumns = "id, created_at, updated_at, url, secret, events, consecutive_failures, disabled_at"
+
+// maxDeliveryErrorLength is the length of the error column of the deliveries, longer errors are truncated
+const maxDeliveryErrorLength = 1024
+
+// MysqlWebhookRepository provides the mysql WebhookRepository implementation
+type MysqlWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewMysqlWebhookRepository(db *sql.DB) *MysqlWebhookRepository {
+	return &MysqlWebhookRepository{
+		db: db,
+	}
+}
+
+func (r *MysqlWebhookRepository) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto(webhookTable)
+	ib.Cols("id", "created_at", "updated_at", "url", "secret", "events")
+	ib.Values(webhook.ID, webhook.CreatedAt, webhook.UpdatedAt, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","))
+	query, args := ib.Build()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		if dupErr := duplicateEntryError(err); dupErr != nil {
+			return ErrConflict
+		}
+		return fmt.Errorf("can't create webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *MysqlWebhookRepository) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", webhookColumns, webhookTable)
+
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("can't select webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+func (r *MysqlWebhookRepository) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY id ASC", webhookColumns, webhookTable)
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("can't query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*model.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("can't scan row: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get all rows: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (r *MysqlWebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", webhookTable)
+	return r.execOne(ctx, "delete webhook", query, id)
+}
+
+func (r *MysqlWebhookRepository) EnableWebhook(ctx context.Context, id string, updatedAt time.Time) error {
+	query := fmt.Sprintf("UPDATE %s SET updated_at = ?, consecutive_failures = 0, disabled_at = NULL WHERE id = ?", webhookTable)
+	return r.execOne(ctx, "enable webhook", query, updatedAt, id)
+}
+
+func (r *MysqlWebhookRepository) MarkWebhookSucceeded(ctx context.Context, id string) error {
+	query := fmt.Sprintf("UPDATE %s SET consecutive_failures = 0 WHERE id = ?", webhookTable)
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("can't mark webhook as succeeded: %w", err)
+	}
+	return nil
+}
+
+// MarkWebhookFailed relies on MySQL evaluating the assignments from left to right,
+// so disabled_at is compared with the increased consecutive_failures.
+func (r *MysqlWebhookRepository) MarkWebhookFailed(ctx context.Context, id string, disableAfter int, disabledAt time.Time) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET consecutive_failures = consecutive_failures + 1, disabled_at = IF(disabled_at IS NULL AND consecutive_failures >= ?, ?, disabled_at) WHERE id = ?",
+		webhookTable,
+	)
+
+	if _, err := r.db.ExecContext(ctx, query, disableAfter, disabledAt, id); err != nil {
+		return fmt.Errorf("can't mark webhook as failed: %w", err)
+	}
+	return nil
+}
+
+func (r *MysqlWebhookRepository) StoreDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	deliveryErr := delivery.Error
+	if len(deliveryErr) > maxDeliveryErrorLength {
+		deliveryErr = deliveryErr[:maxDeliveryErrorLength]
+	}
+
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto(webhookDeliveryTable)
+	ib.Cols("webhook_id", "created_at", "delivery_id", "topic", "attempt", "status_code", "error", "duration_us")
+	ib.Values(
+		delivery.WebhookID,
+		delivery.CreatedAt,
+		delivery.DeliveryID,
+		delivery.Topic,
+		delivery.Attempt,
+		delivery.StatusCode,
+		deliveryErr,
+		delivery.Duration.Microseconds(),
+	)
+	query, args := ib.Build()
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't store webhook delivery: %w", err)
+	}
+
+	if delivery.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("can't determine webhook delivery ID: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries uses the `by_webhook_id` (webhook_id, id) index
+func (r *MysqlWebhookRepository) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error) {
+	query := fmt.Sprintf(
+		"SELECT id, webhook_id, created_at, delivery_id, topic, attempt, status_code, error, duration_us FROM %s WHERE webhook_id = ? ORDER BY id DESC LIMIT %d",
+		webhookDeliveryTable, limit,
+	)
+
+	rows, err := r.db.QueryContext(ctx, query, webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("can't query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		d := new(model.WebhookDelivery)
+		var durationMicros int64
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.CreatedAt, &d.DeliveryID, &d.Topic, &d.Attempt, &d.StatusCode, &d.Error, &durationMicros); err != nil {
+			return nil, fmt.Errorf("can't scan row: %w", err)
+		}
+		d.Duration = time.Duration(durationMicros) * time.Microsecond
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't get all rows: %w", err)
+	}
+	return deliveries, nil
+}
+
+// DeleteDeliveries uses the `by_created_at` index
+func (r *MysqlWebhookRepository) DeleteDeliveries(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE created_at < ? ORDER BY created_at ASC LIMIT %d", webhookDeliveryTable, limit)
+
+	res, err := r.db.ExecContext(ctx, query, createdBefore)
+	if err != nil {
+		return 0, fmt.Errorf("can't delete webhook deliveries: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't determine rows affected: %w", err)
+	}
+	return int(affected), nil
+}
+
+// execOne executes the query failing with ErrNotFound if no rows were affected
+func (r *MysqlWebhookRepository) execOne(ctx context.Context, operation, query string, args ...interface{}) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("can't %s: %w", operation, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't determine rows affected: %w", err)
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanWebhook expects the webhookColumns to be selected
+func scanWebhook(row rowScanner) (*model.Webhook, error) {
+	w := new(model.Webhook)
+	var events string
+	var disabledAt *time.Time
+	if err := row.Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt, &w.URL, &w.Secret, &events, &w.ConsecutiveFailures, &disabledAt); err != nil {
+		return nil, err
+	}
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	w.DisabledAt = timeOrZero(disabledAt)
+	return w, nil
+}
@@ -11,25 +11,47 @@ import (
 // CRUDObserver defines the repository operations observer functionality.
 type CRUDObserver interface {
 	OnCreate(context.Context, *model.User) error
-	OnUpdate(context.Context, *model.User) error
-	OnDelete(context.Context, string) error
+	// OnUpdate receives the user as it was before the update too
+	OnUpdate(ctx context.Context, prev, user *model.User) error
+	// OnDelete receives the ID of the deleted user and the version of the deletion
+	OnDelete(ctx context.Context, id string, version int64) error
 }
 
 //go:generate mockery -inpkg -testonly -case underscore -name CRUDObserver
 
+// SoftDeleteObserver is implemented by the CRUDObservers that are notified about the deletions as soon as the users are
+// marked as deleted, and about their restorations, instead of waiting until they're erased or purged like the rest.
+// They're notified about the erasures and purges too.
+type SoftDeleteObserver interface {
+	// OnSoftDelete receives the ID of the user marked as deleted and the version of the deletion
+	OnSoftDelete(ctx context.Context, id string, version int64) error
+	// OnRestore receives the restored user
+	OnRestore(ctx context.Context, user *model.User) error
+}
+
+//go:generate mockery -inpkg -testonly -case underscore -name SoftDeleteObserver
+
 // ObservedRepository will try to notify the registered observers on CRUD operations.
 // Failed observer calls won't fail the CRUD calls on this repository implementation, they will be logged as warnings.
+// Observers are called synchronously, wrap them with an AsyncObserver to notify them in background.
 type ObservedRepository struct {
 	Repository
-	observers []CRUDObserver
+	observers           []CRUDObserver
+	softDeleteObservers []SoftDeleteObserver
 }
 
 // NewObservedRepository creates a new ObservedRepository
 func NewObservedRepository(repo Repository, observers ...CRUDObserver) *ObservedRepository {
-	return &ObservedRepository{
+	r := &ObservedRepository{
 		Repository: repo,
 		observers:  observers,
 	}
+	for _, ob := range observers {
+		if sd, ok := softDeleteObserver(ob); ok {
+			r.softDeleteObservers = append(r.softDeleteObservers, sd)
+		}
+	}
+	return r
 }
 
 func (r *ObservedRepository) Create(ctx context.Context, user *model.User) error {
@@ -45,28 +67,106 @@ func (r *ObservedRepository) Create(ctx context.Context, user *model.User) error
 	return nil
 }
 
-func (r *ObservedRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) error {
-	err := r.Repository.Update(ctx, user, prevUpdatedAt)
+func (r *ObservedRepository) Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) (*model.User, error) {
+	prev, err := r.Repository.Update(ctx, user, prevUpdatedAt)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, ob := range r.observers {
-		if err := ob.OnUpdate(ctx, user); err != nil {
+		if err := ob.OnUpdate(ctx, prev, user); err != nil {
 			log.For(ctx).Warningf("Can't notify observer %T OnUpdate: %s", ob, err)
 		}
 	}
-	return nil
+	return prev, nil
+}
+
+func (r *ObservedRepository) Delete(ctx context.Context, id string, deletedAt time.Time) (*model.User, error) {
+	deleted, err := r.Repository.Delete(ctx, id, deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.notifySoftDelete(ctx, deleted)
+	return deleted, nil
 }
 
-func (r *ObservedRepository) Delete(ctx context.Context, id string) error {
-	err := r.Repository.Delete(ctx, id)
+func (r *ObservedRepository) DeleteVersioned(ctx context.Context, id string, prevUpdatedAt, deletedAt time.Time) (*model.User, error) {
+	deleted, err := r.Repository.DeleteVersioned(ctx, id, prevUpdatedAt, deletedAt)
 	if err != nil {
+		return nil, err
+	}
+	r.notifySoftDelete(ctx, deleted)
+	return deleted, nil
+}
+
+// Restore retrieves the restored user to notify the SoftDeleteObservers, if there are any.
+func (r *ObservedRepository) Restore(ctx context.Context, id string, restoredAt time.Time) error {
+	if err := r.Repository.Restore(ctx, id, restoredAt); err != nil {
 		return err
 	}
+	if len(r.softDeleteObservers) == 0 {
+		return nil
+	}
+
+	user, err := r.Repository.Get(ctx, id)
+	if err != nil {
+		log.For(ctx).Warningf("Can't retrieve restored user to notify the observers: %s", err)
+		return nil
+	}
+	for _, ob := range r.softDeleteObservers {
+		if err := ob.OnRestore(ctx, user); err != nil {
+			log.For(ctx).Warningf("Can't notify observer %T OnRestore: %s", ob, err)
+		}
+	}
+	return nil
+}
+
+// Erase notifies the observers about the deletion, as the erased user can't be restored.
+func (r *ObservedRepository) Erase(ctx context.Context, id string) (*model.User, error) {
+	erased, err := r.Repository.Erase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	for _, ob := range r.observers {
-		if err := ob.OnDelete(ctx, id); err != nil {
+		if err := ob.OnDelete(ctx, erased.ID, erased.Version); err != nil {
 			log.For(ctx).Warningf("Can't notify observer %T OnDelete: %s", ob, err)
 		}
 	}
-	return nil
+	return erased, nil
+}
+
+// Purge notifies the observers about the deletion of each purged user, as that's when the users are actually deleted.
+// Delete and Restore are only notified to the SoftDeleteObservers, since the deleted users can still be restored.
+func (r *ObservedRepository) Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*model.User, error) {
+	purged, err := r.Repository.Purge(ctx, deletedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range purged {
+		for _, ob := range r.observers {
+			if err := ob.OnDelete(ctx, u.ID, u.Version); err != nil {
+				log.For(ctx).Warningf("Can't notify observer %T OnDelete: %s", ob, err)
+			}
+		}
+	}
+	return purged, nil
+}
+
+func (r *ObservedRepository) notifySoftDelete(ctx context.Context, deleted *model.User) {
+	for _, ob := range r.softDeleteObservers {
+		if err := ob.OnSoftDelete(ctx, deleted.ID, deleted.Version); err != nil {
+			log.For(ctx).Warningf("Can't notify observer %T OnSoftDelete: %s", ob, err)
+		}
+	}
+}
+
+// softDeleteObserver looks through the AsyncObservers, as they implement SoftDeleteObserver
+// even if the wrapped observer doesn't.
+func softDeleteObserver(ob CRUDObserver) (SoftDeleteObserver, bool) {
+	if async, ok := ob.(*AsyncObserver); ok {
+		if _, ok := async.observer.(SoftDeleteObserver); !ok {
+			return nil, false
+		}
+	}
+	sd, ok := ob.(SoftDeleteObserver)
+	return sd, ok
 }
@@ -54,76 +54,169 @@ func TestObservedRepository_Update(t *testing.T) {
 
 	t.Run("repository call succeeds", func(t *testing.T) {
 		repository := &MockRepository{}
-		repository.On("Update", mock.Anything, someUser, someTime).Return(nil)
+		prevUser := &model.User{ID: someUserID, UpdatedAt: someTime}
+		repository.On("Update", mock.Anything, someUser, someTime).Return(prevUser, nil)
 
 		observer1 := &MockCRUDObserver{}
-		observer1.On("OnUpdate", mock.Anything, someUser).Return(errors.New("broken"))
+		observer1.On("OnUpdate", mock.Anything, prevUser, someUser).Return(errors.New("broken"))
 
 		observer2 := &MockCRUDObserver{}
-		observer2.On("OnUpdate", mock.Anything, someUser).Return(errors.New("broken too"))
+		observer2.On("OnUpdate", mock.Anything, prevUser, someUser).Return(errors.New("broken too"))
 
 		observed := NewObservedRepository(repository, observer1, observer2)
-		err := observed.Update(context.Background(), someUser, someTime)
+		prev, err := observed.Update(context.Background(), someUser, someTime)
 		assert.NoError(t, err)
+		assert.Equal(t, prevUser, prev)
 
 		mock.AssertExpectationsForObjects(t, observer1, observer2)
 	})
 
 	t.Run("repository call fails", func(t *testing.T) {
 		repository := &MockRepository{}
-		repository.On("Update", mock.Anything, someUser, someTime).Return(expectedErr)
+		repository.On("Update", mock.Anything, someUser, someTime).Return(nil, expectedErr)
 
 		observer := &MockCRUDObserver{}
 
 		observed := NewObservedRepository(repository, observer)
-		err := observed.Update(context.Background(), someUser, someTime)
+		_, err := observed.Update(context.Background(), someUser, someTime)
 		assert.Equal(t, expectedErr, err)
 
-		observer.AssertNotCalled(t, "OnUpdate", mock.Anything, mock.Anything)
+		observer.AssertNotCalled(t, "OnUpdate", mock.Anything, mock.Anything, mock.Anything)
 	})
 }
 
 func TestObservedRepository_Delete(t *testing.T) {
+	deletedAt := time.Now()
+	deleted := &model.User{ID: someUserID, Version: 3}
+
+	t.Run("only soft delete observers are notified", func(t *testing.T) {
+		repository := &MockRepository{}
+		repository.On("Delete", mock.Anything, someUserID, deletedAt).Return(deleted, nil)
+
+		observer := &MockCRUDObserver{}
+		softDeleteObserver := newMockSoftDeleteCRUDObserver()
+		softDeleteObserver.sd.On("OnSoftDelete", mock.Anything, someUserID, int64(3)).Return(errors.New("broken"))
+
+		observed := NewObservedRepository(repository, observer, softDeleteObserver)
+		res, err := observed.Delete(context.Background(), someUserID, deletedAt)
+		assert.NoError(t, err)
+		assert.Equal(t, deleted, res)
+
+		// deleted users are notified to the rest when they're purged, as they can be restored until then
+		observer.AssertNotCalled(t, "OnDelete", mock.Anything, mock.Anything, mock.Anything)
+		softDeleteObserver.sd.AssertExpectations(t)
+	})
+
+	t.Run("versioned", func(t *testing.T) {
+		repository := &MockRepository{}
+		repository.On("DeleteVersioned", mock.Anything, someUserID, deletedAt, deletedAt).Return(deleted, nil)
+
+		softDeleteObserver := newMockSoftDeleteCRUDObserver()
+		softDeleteObserver.sd.On("OnSoftDelete", mock.Anything, someUserID, int64(3)).Return(nil)
+
+		observed := NewObservedRepository(repository, softDeleteObserver)
+		_, err := observed.DeleteVersioned(context.Background(), someUserID, deletedAt, deletedAt)
+		assert.NoError(t, err)
+
+		softDeleteObserver.sd.AssertExpectations(t)
+	})
+
+	t.Run("repository call fails", func(t *testing.T) {
+		repository := &MockRepository{}
+		repository.On("Delete", mock.Anything, someUserID, deletedAt).Return(nil, expectedErr)
+
+		softDeleteObserver := newMockSoftDeleteCRUDObserver()
+
+		observed := NewObservedRepository(repository, softDeleteObserver)
+		_, err := observed.Delete(context.Background(), someUserID, deletedAt)
+		assert.Equal(t, expectedErr, err)
+
+		softDeleteObserver.sd.AssertNotCalled(t, "OnSoftDelete", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestObservedRepository_Restore(t *testing.T) {
+	restoredAt := time.Now()
+
+	t.Run("soft delete observers receive the restored user", func(t *testing.T) {
+		repository := &MockRepository{}
+		repository.On("Restore", mock.Anything, someUserID, restoredAt).Return(nil)
+		repository.On("Get", mock.Anything, someUserID).Return(someUser, nil)
+
+		observer := &MockCRUDObserver{}
+		softDeleteObserver := newMockSoftDeleteCRUDObserver()
+		softDeleteObserver.sd.On("OnRestore", mock.Anything, someUser).Return(nil)
+
+		observed := NewObservedRepository(repository, observer, softDeleteObserver)
+		assert.NoError(t, observed.Restore(context.Background(), someUserID, restoredAt))
+
+		mock.AssertExpectationsForObjects(t, repository, softDeleteObserver.sd)
+		observer.AssertNotCalled(t, "OnCreate", mock.Anything, mock.Anything)
+	})
+
+	t.Run("restored user isn't retrieved without soft delete observers", func(t *testing.T) {
+		repository := &MockRepository{}
+		repository.On("Restore", mock.Anything, someUserID, restoredAt).Return(nil)
+
+		async, err := NewAsyncObserver("test", &MockCRUDObserver{}, AsyncObserverConfig{QueueSize: 1, Workers: 1, FullQueuePolicy: FullQueueDrop})
+		assert.NoError(t, err)
+		defer async.Close(context.Background())
+
+		observed := NewObservedRepository(repository, &MockCRUDObserver{}, async)
+		assert.NoError(t, observed.Restore(context.Background(), someUserID, restoredAt))
+
+		repository.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	})
+}
+
+func TestObservedRepository_Purge(t *testing.T) {
+	deletedBefore := time.Now()
+	const limit = 10
+
 	t.Run("repository call succeeds", func(t *testing.T) {
 		repository := &MockRepository{}
-		repository.On("Delete", mock.Anything, someUserID).Return(nil)
+		purgedUsers := []*model.User{{ID: "foo", Version: 2}, {ID: "bar", Version: 5}}
+		repository.On("Purge", mock.Anything, deletedBefore, limit).Return(purgedUsers, nil)
 
 		observer1 := &MockCRUDObserver{}
-		observer1.On("OnDelete", mock.Anything, someUserID).Return(errors.New("broken"))
+		observer1.On("OnDelete", mock.Anything, "foo", int64(2)).Return(errors.New("broken"))
+		observer1.On("OnDelete", mock.Anything, "bar", int64(5)).Return(nil)
 
 		observer2 := &MockCRUDObserver{}
-		observer2.On("OnDelete", mock.Anything, someUserID).Return(errors.New("broken too"))
+		observer2.On("OnDelete", mock.Anything, "foo", int64(2)).Return(nil)
+		observer2.On("OnDelete", mock.Anything, "bar", int64(5)).Return(nil)
 
 		observed := NewObservedRepository(repository, observer1, observer2)
-		err := observed.Delete(context.Background(), someUserID)
+		purged, err := observed.Purge(context.Background(), deletedBefore, limit)
 		assert.NoError(t, err)
+		assert.Equal(t, purgedUsers, purged)
 
 		mock.AssertExpectationsForObjects(t, observer1, observer2)
 	})
 
 	t.Run("repository call fails", func(t *testing.T) {
 		repository := &MockRepository{}
-		repository.On("Delete", mock.Anything, someUserID).Return(expectedErr)
+		repository.On("Purge", mock.Anything, deletedBefore, limit).Return(nil, expectedErr)
 
 		observer := &MockCRUDObserver{}
 
 		observed := NewObservedRepository(repository, observer)
-		err := observed.Delete(context.Background(), someUserID)
+		_, err := observed.Purge(context.Background(), deletedBefore, limit)
 		assert.Equal(t, expectedErr, err)
 
-		observer.AssertNotCalled(t, "OnDelete", mock.Anything, mock.Anything)
+		observer.AssertNotCalled(t, "OnDelete", mock.Anything, mock.Anything, mock.Anything)
 	})
 }
 
 func TestObservedRepository_ListAll(t *testing.T) {
 	users := []*model.User{someUser, someUser}
 	repository := &MockRepository{}
-	repository.On("ListAll", mock.Anything).Return(users, nil)
+	repository.On("ListAll", mock.Anything, false).Return(users, nil)
 
 	observer := &MockCRUDObserver{}
 
 	observed := NewObservedRepository(repository, observer)
-	got, err := observed.ListAll(context.Background())
+	got, err := observed.ListAll(context.Background(), false)
 	assert.NoError(t, err)
 	assert.Equal(t, users, got)
 }
@@ -131,12 +224,30 @@ func TestObservedRepository_ListAll(t *testing.T) {
 func TestObservedRepository_ListCountry(t *testing.T) {
 	users := []*model.User{someUser, someUser}
 	repository := &MockRepository{}
-	repository.On("ListCountry", mock.Anything, "xx").Return(users, nil)
+	repository.On("ListCountry", mock.Anything, "xx", false).Return(users, nil)
 
 	observer := &MockCRUDObserver{}
 
 	observed := NewObservedRepository(repository, observer)
-	got, err := observed.ListCountry(context.Background(), "xx")
+	got, err := observed.ListCountry(context.Background(), "xx", false)
 	assert.NoError(t, err)
 	assert.Equal(t, users, got)
 }
+
+// mockSoftDeleteCRUDObserver is a CRUDObserver implementing the SoftDeleteObserver too
+type mockSoftDeleteCRUDObserver struct {
+	*MockCRUDObserver
+	sd *MockSoftDeleteObserver
+}
+
+func newMockSoftDeleteCRUDObserver() *mockSoftDeleteCRUDObserver {
+	return &mockSoftDeleteCRUDObserver{MockCRUDObserver: &MockCRUDObserver{}, sd: &MockSoftDeleteObserver{}}
+}
+
+func (m *mockSoftDeleteCRUDObserver) OnSoftDelete(ctx context.Context, id string, version int64) error {
+	return m.sd.OnSoftDelete(ctx, id, version)
+}
+
+func (m *mockSoftDeleteCRUDObserver) OnRestore(ctx context.Context, user *model.User) error {
+	return m.sd.OnRestore(ctx, user)
+}
@@ -0,0 +1,52 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+)
+
+// OutboxMessage is an event stored in the outbox, waiting to be published
+type OutboxMessage struct {
+	// ID is increased on every stored message, so it defines the order of the messages
+	ID        int64
+	CreatedAt time.Time
+	Topic     string
+	Payload   []byte
+	// Attempts is the number of failed attempts to publish this message
+	Attempts int
+}
+
+// OutboxEncoder builds the messages stored in the outbox for the CRUD operations.
+// They're stored in the same transaction as the operation, so they're never lost once the operation is committed.
+// The context provided is the one of the operation, so the trace context can be included in the payload.
+type OutboxEncoder interface {
+	EncodeCreate(ctx context.Context, user *model.User) (topic string, payload []byte, err error)
+	// EncodeUpdate receives the user as it was before the update too
+	EncodeUpdate(ctx context.Context, prev, user *model.User) (topic string, payload []byte, err error)
+	// EncodeDelete receives the version of the deletion, as the deleted user is not available anymore
+	EncodeDelete(ctx context.Context, userID string, version int64) (topic string, payload []byte, err error)
+}
+
+//go:generate mockery -inpkg -testonly -case underscore -name OutboxEncoder
+
+// Outbox provides the messages stored by the repository to the relay that publishes them
+type Outbox interface {
+	// LockRelay acquires the lock that allows a single relay to publish the messages at a time, so they're published
+	// in order even when several instances of the service are running. It returns false if another relay holds it.
+	// The unlock function returned has to be called once the messages are published.
+	LockRelay(ctx context.Context) (unlock func(), acquired bool, err error)
+	// Pending retrieves up to limit undelivered messages, sorted by ID
+	Pending(ctx context.Context, limit int) ([]*OutboxMessage, error)
+	// MarkDelivered marks the message as delivered, so it's not retrieved as pending anymore
+	MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error
+	// MarkFailed increases the failed attempts of the message
+	MarkFailed(ctx context.Context, id int64) error
+	// DeleteDelivered deletes up to limit messages delivered before deliveredBefore, returning how many were deleted
+	DeleteDelivered(ctx context.Context, deliveredBefore time.Time, limit int) (int, error)
+	// CountPending returns the amount of undelivered messages
+	CountPending(ctx context.Context) (int, error)
+}
+
+//go:generate mockery -output persistencemock -outpkg persistencemock -case underscore -name Outbox
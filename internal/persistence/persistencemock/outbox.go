@@ -0,0 +1,140 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package persistencemock
+
+import (
+	context "context"
+
+	persistence "github.com/a-faceit-candidate/userservice/internal/persistence"
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
+
+// Outbox is an autogenerated mock type for the Outbox type
+type Outbox struct {
+	mock.Mock
+}
+
+// CountPending provides a mock function with given fields: ctx
+func (_m *Outbox) CountPending(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteDelivered provides a mock function with given fields: ctx, deliveredBefore, limit
+func (_m *Outbox) DeleteDelivered(ctx context.Context, deliveredBefore time.Time, limit int) (int, error) {
+	ret := _m.Called(ctx, deliveredBefore, limit)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) int); ok {
+		r0 = rf(ctx, deliveredBefore, limit)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, deliveredBefore, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LockRelay provides a mock function with given fields: ctx
+func (_m *Outbox) LockRelay(ctx context.Context) (func(), bool, error) {
+	ret := _m.Called(ctx)
+
+	var r0 func()
+	if rf, ok := ret.Get(0).(func(context.Context) func()); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(func())
+		}
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(context.Context) bool); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context) error); ok {
+		r2 = rf(ctx)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// MarkDelivered provides a mock function with given fields: ctx, id, deliveredAt
+func (_m *Outbox) MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error {
+	ret := _m.Called(ctx, id, deliveredAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, time.Time) error); ok {
+		r0 = rf(ctx, id, deliveredAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MarkFailed provides a mock function with given fields: ctx, id
+func (_m *Outbox) MarkFailed(ctx context.Context, id int64) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Pending provides a mock function with given fields: ctx, limit
+func (_m *Outbox) Pending(ctx context.Context, limit int) ([]*persistence.OutboxMessage, error) {
+	ret := _m.Called(ctx, limit)
+
+	var r0 []*persistence.OutboxMessage
+	if rf, ok := ret.Get(0).(func(context.Context, int) []*persistence.OutboxMessage); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*persistence.OutboxMessage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,191 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package persistencemock
+
+import (
+	context "context"
+
+	model "github.com/a-faceit-candidate/userservice/internal/model"
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+)
+
+// WebhookRepository is an autogenerated mock type for the WebhookRepository type
+type WebhookRepository struct {
+	mock.Mock
+}
+
+// CreateWebhook provides a mock function with given fields: ctx, webhook
+func (_m *WebhookRepository) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	ret := _m.Called(ctx, webhook)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Webhook) error); ok {
+		r0 = rf(ctx, webhook)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteDeliveries provides a mock function with given fields: ctx, createdBefore, limit
+func (_m *WebhookRepository) DeleteDeliveries(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	ret := _m.Called(ctx, createdBefore, limit)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) int); ok {
+		r0 = rf(ctx, createdBefore, limit)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, createdBefore, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteWebhook provides a mock function with given fields: ctx, id
+func (_m *WebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnableWebhook provides a mock function with given fields: ctx, id, updatedAt
+func (_m *WebhookRepository) EnableWebhook(ctx context.Context, id string, updatedAt time.Time) error {
+	ret := _m.Called(ctx, id, updatedAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, updatedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetWebhook provides a mock function with given fields: ctx, id
+func (_m *WebhookRepository) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Webhook); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeliveries provides a mock function with given fields: ctx, webhookID, limit
+func (_m *WebhookRepository) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error) {
+	ret := _m.Called(ctx, webhookID, limit)
+
+	var r0 []*model.WebhookDelivery
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []*model.WebhookDelivery); ok {
+		r0 = rf(ctx, webhookID, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.WebhookDelivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, webhookID, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListWebhooks provides a mock function with given fields: ctx
+func (_m *WebhookRepository) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []*model.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context) []*model.Webhook); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MarkWebhookFailed provides a mock function with given fields: ctx, id, disableAfter, disabledAt
+func (_m *WebhookRepository) MarkWebhookFailed(ctx context.Context, id string, disableAfter int, disabledAt time.Time) error {
+	ret := _m.Called(ctx, id, disableAfter, disabledAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, time.Time) error); ok {
+		r0 = rf(ctx, id, disableAfter, disabledAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MarkWebhookSucceeded provides a mock function with given fields: ctx, id
+func (_m *WebhookRepository) MarkWebhookSucceeded(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StoreDelivery provides a mock function with given fields: ctx, delivery
+func (_m *WebhookRepository) StoreDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	ret := _m.Called(ctx, delivery)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.WebhookDelivery) error); ok {
+		r0 = rf(ctx, delivery)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
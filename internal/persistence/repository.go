@@ -8,23 +8,65 @@ import (
 	"github.com/a-faceit-candidate/userservice/internal/model"
 )
 
+// Repository persists the users, increasing their Version on every write.
 type Repository interface {
-	// Create will create a user. It expects the ID and CreatedAt, UpdatedAt fields to be filled.
+	// Create will create a user. It expects the ID and CreatedAt, UpdatedAt fields to be filled, and sets its Version to 1.
 	// It will fail with ErrConflict there's already a user with that ID.
+	// It will fail with ErrDuplicateEmail if there's already a user with same email,
+	// or with ErrDuplicateEmailOfDeletedUser if that user is deleted but not purged yet.
 	Create(context.Context, *model.User) error
 	// Update will update the user with same ID and same prevUpdatedAt timestamp,
 	// if the UpdatedAt in the DB differs, it fail with ErrConflict.
 	// If user doesn't exist, it will fail with ErrNotFound
-	// If PasswordHash or PasswordSalt are not provided, they won't be updated
-	Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) error
+	// If PasswordHash is not provided, neither PasswordHash nor PasswordSalt will be updated.
+	// If PasswordHash is provided, PasswordSalt is updated too, even if empty, as current hashes embed their salt.
+	// If another user already has the same email, it will fail with ErrDuplicateEmail, or ErrDuplicateEmailOfDeletedUser
+	// It sets the Version of the user provided to the next one of the stored user.
+	// It returns the user as it was before the update, without PasswordHash and PasswordSalt.
+	Update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) (prev *model.User, err error)
+	// UpdatePasswordHash replaces the password hash of the user if the stored one is still prevHash,
+	// otherwise it fails with ErrConflict. The password salt is cleared, as new hashes embed their salt.
+	// It doesn't modify the UpdatedAt field since the password itself doesn't change.
+	UpdatePasswordHash(ctx context.Context, id, prevHash, newHash string) error
 	// Get will retrieve a user with the ID provided, or ErrNotFound if not found.
+	// PasswordHash and PasswordSalt are not retrieved, use GetCredentials for that.
 	Get(context.Context, string) (*model.User, error)
-	// Delete will delete the user with the ID provided. It will return ErrNotFound if no users were found.
-	Delete(context.Context, string) error
-	// ListAll retrieves all the users.
-	ListAll(context.Context) ([]*model.User, error)
+	// GetByEmail will retrieve the user with the email provided, compared case-insensitively, or ErrNotFound if not found.
+	// PasswordHash and PasswordSalt are not retrieved, use GetCredentialsByEmail for that.
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// GetCredentials works like Get, but it also retrieves the PasswordHash and PasswordSalt.
+	GetCredentials(ctx context.Context, id string) (*model.User, error)
+	// GetCredentialsByEmail works like GetByEmail, but it also retrieves the PasswordHash and PasswordSalt.
+	GetCredentialsByEmail(ctx context.Context, email string) (*model.User, error)
+	// Delete will mark as deleted the user with the ID provided, setting its DeletedAt and UpdatedAt to deletedAt,
+	// returning its ID and the Version of the deletion, the rest of the fields aren't provided.
+	// Deleted users are ignored by all the other methods, except for Restore, Purge and the lists including them.
+	// It will return ErrNotFound if no users were found.
+	Delete(ctx context.Context, id string, deletedAt time.Time) (*model.User, error)
+	// DeleteVersioned works like Delete if the user's UpdatedAt is still prevUpdatedAt,
+	// otherwise it will fail with ErrConflict. It will return ErrNotFound if no users were found.
+	DeleteVersioned(ctx context.Context, id string, prevUpdatedAt, deletedAt time.Time) (*model.User, error)
+	// Restore will unmark as deleted the user with the ID provided, setting its UpdatedAt to restoredAt.
+	// It will return ErrNotFound if there's no deleted user with that ID.
+	Restore(ctx context.Context, id string, restoredAt time.Time) error
+	// Purge will permanently delete up to limit users deleted before deletedBefore,
+	// returning their IDs and the Version of the purge, the rest of the fields aren't provided.
+	Purge(ctx context.Context, deletedBefore time.Time, limit int) ([]*model.User, error)
+	// Erase will permanently delete the user with the ID provided, even if it's deleted,
+	// returning its ID and the Version of the erasure, the rest of the fields aren't provided.
+	// It will return ErrNotFound if no users were found.
+	Erase(ctx context.Context, id string) (*model.User, error)
+	// ListAll retrieves all the users, without their PasswordHash and PasswordSalt.
+	// Deleted users are only retrieved if includeDeleted is true, which applies to the other list methods too.
+	ListAll(ctx context.Context, includeDeleted bool) ([]*model.User, error)
 	// ListCountry retrieves all the users from the given country.
-	ListCountry(ctx context.Context, countryCode string) ([]*model.User, error)
+	ListCountry(ctx context.Context, countryCode string, includeDeleted bool) ([]*model.User, error)
+	// ListAllAfter retrieves up to limit users sorted by ID, starting after the provided afterID.
+	// An empty afterID starts from the first user.
+	ListAllAfter(ctx context.Context, afterID string, limit int, includeDeleted bool) ([]*model.User, error)
+	// ListCountryAfter retrieves up to limit users from the given country sorted by ID, starting after the provided afterID.
+	// An empty afterID starts from the first user of that country.
+	ListCountryAfter(ctx context.Context, countryCode, afterID string, limit int, includeDeleted bool) ([]*model.User, error)
 }
 
 //go:generate mockery -output persistencemock -outpkg persistencemock -case unserscore -name Repository
@@ -32,3 +74,10 @@ type Repository interface {
 
 var ErrNotFound = errors.New("not found")
 var ErrConflict = errors.New("conflict updating")
+
+// ErrDuplicateEmail is returned when another user already has the same email (emails are compared case-insensitively)
+var ErrDuplicateEmail = errors.New("duplicate email")
+
+// ErrDuplicateEmailOfDeletedUser is returned instead of ErrDuplicateEmail when the user having the same email is deleted,
+// since deleted users keep their emails until they're purged.
+var ErrDuplicateEmailOfDeletedUser = errors.New("duplicate email of a deleted user")
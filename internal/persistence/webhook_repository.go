@@ -0,0 +1,38 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+)
+
+// WebhookRepository persists the webhooks and the log of their deliveries
+type WebhookRepository interface {
+	// CreateWebhook expects the ID, CreatedAt and UpdatedAt fields to be filled.
+	// It will fail with ErrConflict if there's already a webhook with that ID.
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	// GetWebhook will retrieve the webhook with the ID provided, or ErrNotFound if not found.
+	GetWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	// ListWebhooks retrieves all the webhooks sorted by ID, including the disabled ones.
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	// DeleteWebhook will delete the webhook with the ID provided, or return ErrNotFound if not found.
+	// Its deliveries are kept until they're deleted by DeleteDeliveries.
+	DeleteWebhook(ctx context.Context, id string) error
+	// EnableWebhook clears the DisabledAt and ConsecutiveFailures of the webhook, setting its UpdatedAt to updatedAt.
+	// It will return ErrNotFound if no webhooks were found.
+	EnableWebhook(ctx context.Context, id string, updatedAt time.Time) error
+	// MarkWebhookSucceeded resets the ConsecutiveFailures of the webhook.
+	MarkWebhookSucceeded(ctx context.Context, id string) error
+	// MarkWebhookFailed increases the ConsecutiveFailures of the webhook,
+	// setting its DisabledAt to disabledAt when they reach disableAfter.
+	MarkWebhookFailed(ctx context.Context, id string, disableAfter int, disabledAt time.Time) error
+	// StoreDelivery stores the delivery in the log, setting its ID.
+	StoreDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	// ListDeliveries retrieves up to limit deliveries of the webhook, newest first.
+	ListDeliveries(ctx context.Context, webhookID string, limit int) ([]*model.WebhookDelivery, error)
+	// DeleteDeliveries deletes up to limit deliveries created before the time provided, returning how many were deleted.
+	DeleteDeliveries(ctx context.Context, createdBefore time.Time, limit int) (int, error)
+}
+
+//go:generate mockery -output persistencemock -outpkg persistencemock -case underscore -name WebhookRepository
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+)
+
+// ChangeType is the kind of change notified by the ChangeFeed
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "user.created"
+	ChangeUpdated ChangeType = "user.updated"
+	ChangeDeleted ChangeType = "user.deleted"
+)
+
+// Change is a notification of a user written by this instance of the service
+type Change struct {
+	// ID increases with every change, it starts at the startup time of the service, so it increases across restarts too.
+	ID      int64
+	Type    ChangeType
+	UserID  string
+	Version int64
+	// User is the state of the user after the change, it's nil for the deleted ones
+	User *model.User
+	// Previous is the state of the user before an update
+	Previous *model.User
+}
+
+// ChangeFeedConfig configures the ChangeFeed
+type ChangeFeedConfig struct {
+	// BufferSize is the amount of latest changes kept for the subscribers resuming from a previous change
+	BufferSize int `default:"1000"`
+	// SubscriberBufferSize is the amount of changes waiting to be read by each subscriber,
+	// slower subscribers are unsubscribed, so they should resume from the last change they've read.
+	SubscriberBufferSize int `default:"100"`
+}
+
+// ChangeFeed implements the persistence.CRUDObserver and persistence.SoftDeleteObserver broadcasting the changes to its subscribers.
+// It only notifies the changes written by this instance of the service, without their passwords.
+type ChangeFeed struct {
+	cfg ChangeFeedConfig
+
+	mu          sync.Mutex
+	closed      bool
+	lastID      int64
+	buffer      []*Change
+	subscribers map[*ChangeSubscription]struct{}
+}
+
+// ChangeSubscription receives the changes through C, which is closed when the subscriber is too slow or it's closed.
+type ChangeSubscription struct {
+	C    <-chan *Change
+	c    chan *Change
+	feed *ChangeFeed
+}
+
+func NewChangeFeed(cfg ChangeFeedConfig) *ChangeFeed {
+	return &ChangeFeed{
+		cfg:         cfg,
+		lastID:      timeNow().UnixNano() / 1000,
+		subscribers: make(map[*ChangeSubscription]struct{}),
+	}
+}
+
+func (f *ChangeFeed) OnCreate(_ context.Context, user *model.User) error {
+	f.publish(&Change{Type: ChangeCreated, UserID: user.ID, Version: user.Version, User: withoutPassword(user)})
+	return nil
+}
+
+func (f *ChangeFeed) OnUpdate(_ context.Context, prev, user *model.User) error {
+	f.publish(&Change{Type: ChangeUpdated, UserID: user.ID, Version: user.Version, User: withoutPassword(user), Previous: withoutPassword(prev)})
+	return nil
+}
+
+func (f *ChangeFeed) OnDelete(_ context.Context, id string, version int64) error {
+	f.publish(&Change{Type: ChangeDeleted, UserID: id, Version: version})
+	return nil
+}
+
+// OnSoftDelete implements the persistence.SoftDeleteObserver, so the subscribers don't wait until the user is purged.
+// The user is notified as deleted again when it's purged.
+func (f *ChangeFeed) OnSoftDelete(ctx context.Context, id string, version int64) error {
+	return f.OnDelete(ctx, id, version)
+}
+
+// OnRestore notifies the restored user as created, since it was notified as deleted
+func (f *ChangeFeed) OnRestore(ctx context.Context, user *model.User) error {
+	return f.OnCreate(ctx, user)
+}
+
+// Subscribe provides the buffered changes after afterID, and a subscription receiving the following ones.
+// If afterID is zero no changes are provided.
+// Complete is false when the changes after afterID aren't buffered anymore, so the subscriber has missed some of them,
+// in that case no changes are provided, as the subscriber should retrieve the current state of the users instead.
+// The subscription should be closed once it's not needed anymore.
+// Once the feed is closed, the channel of the subscriptions is already closed.
+func (f *ChangeFeed) Subscribe(afterID int64) (changes []*Change, complete bool, sub *ChangeSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := make(chan *Change, f.cfg.SubscriberBufferSize)
+	sub = &ChangeSubscription{C: c, c: c, feed: f}
+	if f.closed {
+		close(c)
+		return nil, true, sub
+	}
+	f.subscribers[sub] = struct{}{}
+
+	if afterID == 0 || afterID == f.lastID {
+		return nil, true, sub
+	}
+	// it's a change from the future, probably from a different instance, or the ones after it were discarded
+	if afterID > f.lastID || len(f.buffer) == 0 || afterID < f.buffer[0].ID-1 {
+		return nil, false, sub
+	}
+	return f.bufferedAfter(afterID), true, sub
+}
+
+// Close unsubscribes, closing the channel if it wasn't closed yet
+func (s *ChangeSubscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.feed.unsubscribe(s)
+}
+
+// Close closes all the subscriptions, so the subscribers stop waiting for changes, like when the service is stopped.
+func (f *ChangeFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for sub := range f.subscribers {
+		f.unsubscribe(sub)
+	}
+}
+
+func (f *ChangeFeed) publish(change *Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastID++
+	change.ID = f.lastID
+
+	f.buffer = append(f.buffer, change)
+	if len(f.buffer) > f.cfg.BufferSize {
+		f.buffer = f.buffer[len(f.buffer)-f.cfg.BufferSize:]
+	}
+
+	for sub := range f.subscribers {
+		select {
+		case sub.c <- change:
+		default:
+			f.unsubscribe(sub)
+		}
+	}
+}
+
+// bufferedAfter returns a copy of the buffered changes after the one provided, it should be called holding the lock
+func (f *ChangeFeed) bufferedAfter(afterID int64) []*Change {
+	var changes []*Change
+	for _, ch := range f.buffer {
+		if ch.ID > afterID {
+			changes = append(changes, ch)
+		}
+	}
+	return changes
+}
+
+// unsubscribe should be called holding the lock
+func (f *ChangeFeed) unsubscribe(sub *ChangeSubscription) {
+	if _, ok := f.subscribers[sub]; ok {
+		delete(f.subscribers, sub)
+		close(sub.c)
+	}
+}
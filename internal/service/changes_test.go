@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeed(t *testing.T) {
+	cfg := ChangeFeedConfig{BufferSize: 2, SubscriberBufferSize: 2}
+	firstID := mockedNow.UnixNano()/1000 + 1
+	someUser := &model.User{ID: "some-id", Version: 1, Country: "es", PasswordHash: "$hash"}
+
+	t.Run("notifies the subscribers without passwords", func(t *testing.T) {
+		feed := NewChangeFeed(cfg)
+		_, _, sub := feed.Subscribe(0)
+		defer sub.Close()
+
+		require.NoError(t, feed.OnCreate(context.Background(), someUser))
+		require.NoError(t, feed.OnDelete(context.Background(), "some-id", 2))
+
+		created := <-sub.C
+		assert.Equal(t, firstID, created.ID)
+		assert.Equal(t, ChangeCreated, created.Type)
+		assert.Equal(t, "some-id", created.UserID)
+		assert.Equal(t, int64(1), created.Version)
+		assert.Equal(t, "es", created.User.Country)
+		assert.Empty(t, created.User.PasswordHash)
+
+		deleted := <-sub.C
+		assert.Equal(t, firstID+1, deleted.ID)
+		assert.Equal(t, ChangeDeleted, deleted.Type)
+		assert.Equal(t, int64(2), deleted.Version)
+		assert.Nil(t, deleted.User)
+	})
+
+	t.Run("notifies soft deletions as deletions and restorations as creations", func(t *testing.T) {
+		feed := NewChangeFeed(cfg)
+		_, _, sub := feed.Subscribe(0)
+		defer sub.Close()
+
+		require.NoError(t, feed.OnSoftDelete(context.Background(), "some-id", 2))
+		restored := &model.User{ID: "some-id", Version: 3, Country: "es", PasswordHash: "$hash"}
+		require.NoError(t, feed.OnRestore(context.Background(), restored))
+
+		deleted := <-sub.C
+		assert.Equal(t, ChangeDeleted, deleted.Type)
+		assert.Equal(t, "some-id", deleted.UserID)
+		assert.Equal(t, int64(2), deleted.Version)
+		assert.Nil(t, deleted.User)
+
+		created := <-sub.C
+		assert.Equal(t, ChangeCreated, created.Type)
+		assert.Equal(t, int64(3), created.Version)
+		assert.Equal(t, "es", created.User.Country)
+		assert.Empty(t, created.User.PasswordHash)
+	})
+
+	t.Run("resumes from a buffered change", func(t *testing.T) {
+		feed := NewChangeFeed(cfg)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, feed.OnCreate(context.Background(), someUser))
+		}
+
+		changes, complete, sub := feed.Subscribe(firstID + 1)
+		defer sub.Close()
+		assert.True(t, complete)
+		require.Len(t, changes, 1)
+		assert.Equal(t, firstID+2, changes[0].ID)
+
+		changes, complete, sub = feed.Subscribe(firstID)
+		defer sub.Close()
+		assert.True(t, complete)
+		assert.Len(t, changes, 2)
+
+		changes, complete, sub = feed.Subscribe(firstID + 2)
+		defer sub.Close()
+		assert.True(t, complete)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("discarded changes can't be resumed", func(t *testing.T) {
+		feed := NewChangeFeed(cfg)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, feed.OnCreate(context.Background(), someUser))
+		}
+
+		for name, afterID := range map[string]int64{
+			"discarded":   firstID - 1,
+			"from future": firstID + 10,
+		} {
+			t.Run(name, func(t *testing.T) {
+				changes, complete, sub := feed.Subscribe(afterID)
+				defer sub.Close()
+				assert.False(t, complete)
+				assert.Empty(t, changes)
+			})
+		}
+	})
+
+	t.Run("slow subscribers are unsubscribed", func(t *testing.T) {
+		feed := NewChangeFeed(cfg)
+		_, _, sub := feed.Subscribe(0)
+		defer sub.Close()
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, feed.OnCreate(context.Background(), someUser))
+		}
+
+		var received int
+		for range sub.C {
+			received++
+		}
+		assert.Equal(t, 2, received)
+	})
+	t.Run("closed feed closes the subscriptions", func(t *testing.T) {
+		feed := NewChangeFeed(cfg)
+		_, _, sub := feed.Subscribe(0)
+		defer sub.Close()
+
+		feed.Close()
+		_, ok := <-sub.C
+		assert.False(t, ok)
+
+		_, _, sub = feed.Subscribe(0)
+		defer sub.Close()
+		_, ok = <-sub.C
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,24 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package service
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockPublisher is an autogenerated mock type for the Publisher type
+type MockPublisher struct {
+	mock.Mock
+}
+
+// Publish provides a mock function with given fields: topic, body
+func (_m *MockPublisher) Publish(topic string, body []byte) error {
+	ret := _m.Called(topic, body)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, []byte) error); ok {
+		r0 = rf(topic, body)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
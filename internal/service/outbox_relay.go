@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+	"github.com/a-faceit-candidate/userservice/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// OutboxRelayConfig configures how the outbox messages are published
+type OutboxRelayConfig struct {
+	// Interval is the time between checks for pending messages
+	Interval time.Duration `default:"100ms"`
+	// BatchSize is the maximum amount of messages retrieved at once
+	BatchSize int `default:"100"`
+	// MinBackoff is the time waited after the first publishing failure, it's doubled on every consecutive failure
+	MinBackoff time.Duration `default:"100ms"`
+	// MaxBackoff is the maximum time waited between publishing failures
+	MaxBackoff time.Duration `default:"30s"`
+	// Retention is the time the delivered messages are kept in the outbox
+	Retention time.Duration `default:"168h"`
+	// CleanupInterval is the time between deletions of the delivered messages older than Retention
+	CleanupInterval time.Duration `default:"1h"`
+}
+
+// Publisher publishes the outbox messages, nsq.Producer implements it
+type Publisher interface {
+	Publish(topic string, body []byte) error
+}
+
+//go:generate mockery -inpkg -testonly -case underscore -name Publisher
+
+// OutboxRelay publishes the messages stored in the outbox in the same order they were stored, even across instances.
+// Messages are delivered at least once: if a message can't be marked as delivered after publishing it, it will be published again.
+type OutboxRelay struct {
+	outbox    persistence.Outbox
+	publisher Publisher
+	cfg       OutboxRelayConfig
+}
+
+// NewOutboxRelay provides an OutboxRelay
+func NewOutboxRelay(outbox persistence.Outbox, publisher Publisher, cfg OutboxRelayConfig) *OutboxRelay {
+	return &OutboxRelay{
+		outbox:    outbox,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Run relays the pending messages every configured interval until the context is canceled,
+// backing off exponentially while they can't be published.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	cleanup := time.NewTicker(r.cfg.CleanupInterval)
+	defer cleanup.Stop()
+
+	var backoff time.Duration
+	for {
+		wait := r.cfg.Interval
+		if _, err := r.Relay(ctx); err != nil {
+			backoff = r.nextBackoff(backoff)
+			wait = backoff
+			log.For(ctx).Errorf("Can't relay outbox messages, retrying in %s: %s", backoff, err)
+		} else {
+			backoff = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			r.cleanup(ctx)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Relay publishes the pending messages in batches until there are no more, returning how many were published.
+// It stops on the first message that can't be published, so the following ones aren't published before it.
+// Only one instance relays the messages at a time, if another one is relaying them, it just returns.
+func (r *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	unlock, acquired, err := r.outbox.LockRelay(ctx)
+	if err != nil {
+		return 0, err
+	} else if !acquired {
+		return 0, nil
+	}
+	defer unlock()
+
+	var relayed int
+	for {
+		messages, err := r.outbox.Pending(ctx, r.cfg.BatchSize)
+		if err != nil {
+			return relayed, err
+		}
+
+		for _, msg := range messages {
+			if err := r.publish(ctx, msg); err != nil {
+				if err := r.outbox.MarkFailed(ctx, msg.ID); err != nil {
+					log.For(ctx).Warningf("Can't mark outbox message %d as failed: %s", msg.ID, err)
+				}
+				return relayed, fmt.Errorf("can't publish outbox message %d after %d attempts: %w", msg.ID, msg.Attempts+1, err)
+			}
+			if err := r.outbox.MarkDelivered(ctx, msg.ID, timeNow()); err != nil {
+				return relayed, err
+			}
+			relayed++
+		}
+
+		if len(messages) < r.cfg.BatchSize {
+			return relayed, nil
+		}
+	}
+}
+
+// publish traces the publishing as part of the operation that stored the message, if its trace context is in the payload,
+// so the trace continues even though the message is published later, and maybe by another instance.
+func (r *OutboxRelay) publish(ctx context.Context, msg *persistence.OutboxMessage) (err error) {
+	_, span := tracing.StartPublishSpan(originContext(ctx, msg.Payload), msg.Topic, msg.Payload,
+		attribute.Int64("outbox.message_id", msg.ID),
+		attribute.Int("outbox.attempts", msg.Attempts),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
+	return r.publisher.Publish(msg.Topic, msg.Payload)
+}
+
+// payloadTraceContext is the trace context stored in the payloads of both the envelope and the cloud events formats
+type payloadTraceContext struct {
+	TraceParent string `json:"traceparent"`
+	TraceState  string `json:"tracestate"`
+}
+
+// originContext provides the context of the operation that stored the payload, or ctx if the payload has no trace context,
+// like the payloads of the id format, which aren't even JSON objects.
+func originContext(ctx context.Context, payload []byte) context.Context {
+	var tc payloadTraceContext
+	if err := json.Unmarshal(payload, &tc); err != nil || tc.TraceParent == "" {
+		return ctx
+	}
+	carrier := propagation.HeaderCarrier(http.Header{})
+	carrier.Set("traceparent", tc.TraceParent)
+	carrier.Set("tracestate", tc.TraceState)
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+func (r *OutboxRelay) cleanup(ctx context.Context) {
+	deliveredBefore := timeNow().Add(-r.cfg.Retention)
+	for {
+		deleted, err := r.outbox.DeleteDelivered(ctx, deliveredBefore, r.cfg.BatchSize)
+		if err != nil {
+			log.For(ctx).Errorf("Can't delete delivered outbox messages: %s", err)
+			return
+		}
+		if deleted < r.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return r.cfg.MinBackoff
+	}
+	if backoff *= 2; backoff > r.cfg.MaxBackoff {
+		return r.cfg.MaxBackoff
+	}
+	return backoff
+}
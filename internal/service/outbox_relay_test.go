@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+	"github.com/a-faceit-candidate/userservice/internal/persistence/persistencemock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRelay_Relay(t *testing.T) {
+	cfg := OutboxRelayConfig{BatchSize: 2}
+	someMessage := func(id int64) *persistence.OutboxMessage {
+		return &persistence.OutboxMessage{ID: id, Topic: "user.created", Payload: []byte(`"some-id"`)}
+	}
+
+	t.Run("relays in batches", func(t *testing.T) {
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(func() {}, true, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return([]*persistence.OutboxMessage{someMessage(1), someMessage(2)}, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return([]*persistence.OutboxMessage{someMessage(3)}, nil).Once()
+		outbox.On("MarkDelivered", context.Background(), int64(1), mockedNow).Return(nil).Once()
+		outbox.On("MarkDelivered", context.Background(), int64(2), mockedNow).Return(nil).Once()
+		outbox.On("MarkDelivered", context.Background(), int64(3), mockedNow).Return(nil).Once()
+
+		publisher := &MockPublisher{}
+		publisher.On("Publish", "user.created", []byte(`"some-id"`)).Return(nil).Times(3)
+
+		relayed, err := NewOutboxRelay(outbox, publisher, cfg).Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, relayed)
+		outbox.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("stops on the first publishing failure", func(t *testing.T) {
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(func() {}, true, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return([]*persistence.OutboxMessage{someMessage(1), someMessage(2)}, nil).Once()
+		outbox.On("MarkFailed", context.Background(), int64(1)).Return(nil).Once()
+
+		publisher := &MockPublisher{}
+		publisher.On("Publish", "user.created", []byte(`"some-id"`)).Return(assert.AnError).Once()
+
+		relayed, err := NewOutboxRelay(outbox, publisher, cfg).Relay(context.Background())
+		assert.True(t, errors.Is(err, assert.AnError))
+		assert.Equal(t, 0, relayed)
+		outbox.AssertExpectations(t)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("traces the publishing as part of the operation that stored the message", func(t *testing.T) {
+		payload := []byte(`{"type":"user.created","traceparent":"00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"}`)
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(func() {}, true, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return([]*persistence.OutboxMessage{
+			{ID: 1, Topic: "user.created", Payload: payload},
+			someMessage(2),
+		}, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return(nil, nil).Once()
+		outbox.On("MarkDelivered", context.Background(), mock.Anything, mockedNow).Return(nil).Twice()
+
+		publisher := &MockPublisher{}
+		publisher.On("Publish", "user.created", mock.Anything).Return(nil).Twice()
+
+		spans := endedSpans(func() {
+			relayed, err := NewOutboxRelay(outbox, publisher, cfg).Relay(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 2, relayed)
+		})
+		require.Len(t, spans, 2)
+		assert.Equal(t, "user.created publish", spans[0].Name())
+		assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", spans[0].SpanContext().TraceID().String())
+		assert.Equal(t, "0102030405060708", spans[0].Parent().SpanID().String())
+		// the payloads of the id format don't have a trace context, so a new trace is started
+		assert.False(t, spans[1].Parent().IsValid())
+		assert.NotEqual(t, spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	})
+
+	t.Run("outbox fails", func(t *testing.T) {
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(func() {}, true, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return(nil, assert.AnError).Once()
+
+		relayed, err := NewOutboxRelay(outbox, &MockPublisher{}, cfg).Relay(context.Background())
+		assert.Equal(t, assert.AnError, err)
+		assert.Equal(t, 0, relayed)
+	})
+}
+
+func TestOutboxRelay_Relay_locked(t *testing.T) {
+	t.Run("another instance is relaying", func(t *testing.T) {
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(nil, false, nil).Once()
+
+		relayed, err := NewOutboxRelay(outbox, &MockPublisher{}, OutboxRelayConfig{BatchSize: 2}).Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, relayed)
+		outbox.AssertExpectations(t)
+	})
+
+	t.Run("unlocks once relayed", func(t *testing.T) {
+		var unlocked bool
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(func() { unlocked = true }, true, nil).Once()
+		outbox.On("Pending", context.Background(), 2).Return(nil, nil).Once()
+
+		_, err := NewOutboxRelay(outbox, &MockPublisher{}, OutboxRelayConfig{BatchSize: 2}).Relay(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, unlocked)
+	})
+
+	t.Run("lock fails", func(t *testing.T) {
+		outbox := &persistencemock.Outbox{}
+		outbox.On("LockRelay", context.Background()).Return(nil, false, assert.AnError).Once()
+
+		_, err := NewOutboxRelay(outbox, &MockPublisher{}, OutboxRelayConfig{BatchSize: 2}).Relay(context.Background())
+		assert.Equal(t, assert.AnError, err)
+	})
+}
+
+func TestOutboxRelay_nextBackoff(t *testing.T) {
+	relay := NewOutboxRelay(nil, nil, OutboxRelayConfig{MinBackoff: time.Second, MaxBackoff: 3 * time.Second})
+
+	backoff := relay.nextBackoff(0)
+	assert.Equal(t, time.Second, backoff)
+	backoff = relay.nextBackoff(backoff)
+	assert.Equal(t, 2*time.Second, backoff)
+	backoff = relay.nextBackoff(backoff)
+	assert.Equal(t, 3*time.Second, backoff)
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmScrypt   = "scrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+const (
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+)
+
+// ErrUnsupportedPasswordHash is returned when the encoded password hash wasn't generated by any known algorithm
+var ErrUnsupportedPasswordHash = errors.New("unsupported password hash")
+
+// PasswordHasherConfig configures the algorithm used to hash new passwords and its params.
+// Hashes are verified using the params encoded in them, so changing these won't break existing hashes.
+type PasswordHasherConfig struct {
+	// Algorithm is one of bcrypt, scrypt or argon2id
+	Algorithm string `default:"argon2id"`
+
+	BcryptCost int `default:"12"`
+
+	// ScryptLogN is the log2 of the scrypt N (CPU/memory cost) param
+	ScryptLogN uint8 `default:"15"`
+	ScryptR    int   `default:"8"`
+	ScryptP    int   `default:"1"`
+
+	Argon2Time      uint32 `default:"3"`
+	Argon2MemoryKiB uint32 `default:"65536"`
+	Argon2Threads   uint8  `default:"2"`
+}
+
+// PasswordHasher hashes the passwords into PHC-style encoded strings, like:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// The encoded hash contains the algorithm, its params and the salt, so no other fields are needed to verify it.
+type PasswordHasher interface {
+	// Hash generates a new encoded hash for the password using the configured algorithm.
+	Hash(password string) (string, error)
+	// Verify checks the password against an encoded hash generated by any of the supported algorithms.
+	// It fails with ErrUnsupportedPasswordHash if the hash algorithm is unknown.
+	Verify(password, encodedHash string) (bool, error)
+	// NeedsRehash returns true if the encoded hash wasn't generated with the configured algorithm and params.
+	NeedsRehash(encodedHash string) bool
+}
+
+// NewPasswordHasher provides the PasswordHasher for the given config
+func NewPasswordHasher(cfg PasswordHasherConfig) (PasswordHasher, error) {
+	algorithms := map[string]algorithmHasher{
+		PasswordAlgorithmBcrypt:   bcryptHasher{cost: cfg.BcryptCost},
+		PasswordAlgorithmScrypt:   scryptHasher{logN: cfg.ScryptLogN, r: cfg.ScryptR, p: cfg.ScryptP},
+		PasswordAlgorithmArgon2id: argon2idHasher{time: cfg.Argon2Time, memory: cfg.Argon2MemoryKiB, threads: cfg.Argon2Threads},
+	}
+
+	current, ok := algorithms[cfg.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+	// check the params before we start hashing user passwords with them
+	if _, err := current.hash("password"); err != nil {
+		return nil, fmt.Errorf("invalid %s params: %w", cfg.Algorithm, err)
+	}
+
+	return &phcPasswordHasher{
+		current:    cfg.Algorithm,
+		algorithms: algorithms,
+	}, nil
+}
+
+type phcPasswordHasher struct {
+	current    string
+	algorithms map[string]algorithmHasher
+}
+
+func (h *phcPasswordHasher) Hash(password string) (string, error) {
+	return h.algorithms[h.current].hash(password)
+}
+
+func (h *phcPasswordHasher) Verify(password, encodedHash string) (bool, error) {
+	algorithm, ok := h.algorithms[hashAlgorithm(encodedHash)]
+	if !ok {
+		return false, ErrUnsupportedPasswordHash
+	}
+	return algorithm.verify(password, encodedHash)
+}
+
+func (h *phcPasswordHasher) NeedsRehash(encodedHash string) bool {
+	if hashAlgorithm(encodedHash) != h.current {
+		return true
+	}
+	return !h.algorithms[h.current].sameParams(encodedHash)
+}
+
+// hashAlgorithm returns the algorithm identifier of the encoded hash, or an empty string if it's not known
+func hashAlgorithm(encodedHash string) string {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+	switch parts[1] {
+	case "2a", "2b", "2y":
+		return PasswordAlgorithmBcrypt
+	case PasswordAlgorithmScrypt, PasswordAlgorithmArgon2id:
+		return parts[1]
+	}
+	return ""
+}
+
+type algorithmHasher interface {
+	hash(password string) (string, error)
+	verify(password, encodedHash string) (bool, error)
+	// sameParams returns true when encodedHash was generated with the same params as this hasher
+	sameParams(encodedHash string) bool
+}
+
+// bcryptHasher uses the bcrypt modular crypt format, which is PHC-compatible and already contains the cost
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) hash(password string) (string, error) {
+	if h.cost < bcrypt.MinCost {
+		// bcrypt would silently use the default cost, and then we'd be rehashing on every verification
+		return "", fmt.Errorf("bcrypt cost should be at least %d, got %d", bcrypt.MinCost, h.cost)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) verify(password, encodedHash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (h bcryptHasher) sameParams(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err == nil && cost == h.cost
+}
+
+// scryptHasher encodes the hashes as $scrypt$ln=<logN>,r=<r>,p=<p>$<salt>$<hash>
+type scryptHasher struct {
+	logN uint8
+	r, p int
+}
+
+func (h scryptHasher) hash(password string) (string, error) {
+	salt := randomBytes(passwordSaltLength)
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.logN, h.r, h.p, passwordKeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.logN, h.r, h.p, encodeBase64(salt), encodeBase64(key)), nil
+}
+
+func (h scryptHasher) verify(password, encodedHash string) (bool, error) {
+	params, salt, key, err := decodeScrypt(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	other, err := scrypt.Key([]byte(password), salt, 1<<params.logN, params.r, params.p, len(key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h scryptHasher) sameParams(encodedHash string) bool {
+	params, _, _, err := decodeScrypt(encodedHash)
+	return err == nil && params == h
+}
+
+func decodeScrypt(encodedHash string) (params scryptHasher, salt, key []byte, err error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 5 {
+		return params, nil, nil, fmt.Errorf("%w: scrypt hash should have 5 parts, got %d", ErrUnsupportedPasswordHash, len(parts))
+	}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.logN, &params.r, &params.p); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: can't parse scrypt params: %s", ErrUnsupportedPasswordHash, err)
+	}
+	salt, key, err = decodeSaltAndKey(parts[3], parts[4])
+	return params, salt, key, err
+}
+
+// argon2idHasher encodes the hashes as $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type argon2idHasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func (h argon2idHasher) hash(password string) (string, error) {
+	if h.time == 0 || h.threads == 0 {
+		return "", fmt.Errorf("argon2id time and threads should be greater than zero")
+	}
+	salt := randomBytes(passwordSaltLength)
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, passwordKeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.memory, h.time, h.threads, encodeBase64(salt), encodeBase64(key)), nil
+}
+
+func (h argon2idHasher) verify(password, encodedHash string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h argon2idHasher) sameParams(encodedHash string) bool {
+	params, _, _, err := decodeArgon2id(encodedHash)
+	return err == nil && params == h
+}
+
+func decodeArgon2id(encodedHash string) (params argon2idHasher, salt, key []byte, err error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, fmt.Errorf("%w: argon2id hash should have 6 parts, got %d", ErrUnsupportedPasswordHash, len(parts))
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnsupportedPasswordHash, parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: can't parse argon2id params: %s", ErrUnsupportedPasswordHash, err)
+	}
+	salt, key, err = decodeSaltAndKey(parts[4], parts[5])
+	return params, salt, key, err
+}
+
+// legacyPasswordMatches verifies the hashes generated by previous versions of this service: a hex encoded sha256
+// of the password concatenated with the hex salt, which was stored separately.
+func legacyPasswordMatches(password, hash, salt string) bool {
+	hashArray := sha256.Sum256([]byte(password + salt))
+	expected := hex.EncodeToString(hashArray[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+}
+
+func decodeSaltAndKey(encodedSalt, encodedKey string) (salt, key []byte, err error) {
+	salt, err = base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: can't decode salt: %s", ErrUnsupportedPasswordHash, err)
+	}
+	key, err = base64.RawStdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: can't decode hash: %s", ErrUnsupportedPasswordHash, err)
+	}
+	return salt, key, nil
+}
+
+// encodeBase64 uses the standard base64 encoding without padding, as defined by the PHC string format
+func encodeBase64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+var randomBytes = func(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// this should be enough reason to panic
+		panic(fmt.Errorf("can't read random bytes: %w", err))
+	}
+	return b
+}
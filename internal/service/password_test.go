@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastPasswordHasherConfig uses the cheapest params, we don't want to spend seconds hashing in the tests
+func fastPasswordHasherConfig(algorithm string) PasswordHasherConfig {
+	return PasswordHasherConfig{
+		Algorithm:       algorithm,
+		BcryptCost:      4,
+		ScryptLogN:      4,
+		ScryptR:         8,
+		ScryptP:         1,
+		Argon2Time:      1,
+		Argon2MemoryKiB: 64,
+		Argon2Threads:   1,
+	}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	for _, algorithm := range []string{PasswordAlgorithmBcrypt, PasswordAlgorithmScrypt, PasswordAlgorithmArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			hasher, err := NewPasswordHasher(fastPasswordHasherConfig(algorithm))
+			require.NoError(t, err)
+
+			hash, err := hasher.Hash(somePassword)
+			require.NoError(t, err)
+			assert.NotContains(t, hash, somePassword)
+			assert.Equal(t, algorithm, hashAlgorithm(hash))
+
+			otherHash, err := hasher.Hash(somePassword)
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, otherHash, "hashes should be salted")
+
+			match, err := hasher.Verify(somePassword, hash)
+			assert.NoError(t, err)
+			assert.True(t, match)
+
+			match, err = hasher.Verify("wrong password", hash)
+			assert.NoError(t, err)
+			assert.False(t, match)
+
+			assert.False(t, hasher.NeedsRehash(hash))
+		})
+	}
+
+	t.Run("verifies hashes from other algorithms", func(t *testing.T) {
+		scryptHasher, err := NewPasswordHasher(fastPasswordHasherConfig(PasswordAlgorithmScrypt))
+		require.NoError(t, err)
+		hash, err := scryptHasher.Hash(somePassword)
+		require.NoError(t, err)
+
+		hasher, err := NewPasswordHasher(fastPasswordHasherConfig(PasswordAlgorithmArgon2id))
+		require.NoError(t, err)
+
+		match, err := hasher.Verify(somePassword, hash)
+		assert.NoError(t, err)
+		assert.True(t, match)
+		assert.True(t, hasher.NeedsRehash(hash))
+	})
+
+	t.Run("needs rehash when params change", func(t *testing.T) {
+		hasher, err := NewPasswordHasher(fastPasswordHasherConfig(PasswordAlgorithmArgon2id))
+		require.NoError(t, err)
+		hash, err := hasher.Hash(somePassword)
+		require.NoError(t, err)
+
+		cfg := fastPasswordHasherConfig(PasswordAlgorithmArgon2id)
+		cfg.Argon2Time = 2
+		stronger, err := NewPasswordHasher(cfg)
+		require.NoError(t, err)
+
+		assert.True(t, stronger.NeedsRehash(hash))
+	})
+
+	t.Run("unsupported hash", func(t *testing.T) {
+		hasher, err := NewPasswordHasher(fastPasswordHasherConfig(PasswordAlgorithmArgon2id))
+		require.NoError(t, err)
+
+		_, err = hasher.Verify(somePassword, someLegacyHashedPassword)
+		assert.Equal(t, ErrUnsupportedPasswordHash, err)
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		_, err := NewPasswordHasher(fastPasswordHasherConfig("md5"))
+		assert.Error(t, err)
+	})
+}
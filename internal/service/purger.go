@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+)
+
+// PurgerConfig configures how long the deleted users are kept before being permanently deleted
+type PurgerConfig struct {
+	// Retention is the time the deleted users can be restored before they're purged
+	Retention time.Duration `default:"720h"`
+	// Interval is the time between purges
+	Interval time.Duration `default:"1h"`
+	// BatchSize is the maximum amount of users purged in a single transaction
+	BatchSize int `default:"100"`
+}
+
+// Purger permanently deletes the users deleted longer than the retention period ago
+type Purger struct {
+	repo persistence.Repository
+	cfg  PurgerConfig
+}
+
+// NewPurger provides a Purger, the repository provided is responsible of notifying the purged users
+func NewPurger(repo persistence.Repository, cfg PurgerConfig) *Purger {
+	return &Purger{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// Run purges the users every configured interval until the context is canceled
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.Purge(ctx)
+		if err != nil {
+			log.For(ctx).Errorf("Can't purge deleted users: %s", err)
+		} else if purged > 0 {
+			log.For(ctx).Infof("Purged %d deleted users", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge permanently deletes in batches all the users deleted before the retention period, returning how many were purged
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	deletedBefore := timeNow().Add(-p.cfg.Retention)
+
+	var purged int
+	for {
+		users, err := p.repo.Purge(ctx, deletedBefore, p.cfg.BatchSize)
+		if err != nil {
+			return purged, err
+		}
+		purged += len(users)
+		if len(users) == 0 || len(users) < p.cfg.BatchSize {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence/persistencemock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurger_Purge(t *testing.T) {
+	cfg := PurgerConfig{Retention: time.Hour, BatchSize: 2}
+	deletedBefore := mockedNow.Add(-time.Hour)
+
+	t.Run("purges in batches", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("Purge", context.Background(), deletedBefore, 2).Return([]*model.User{{ID: "a"}, {ID: "b"}}, nil).Once()
+		repository.On("Purge", context.Background(), deletedBefore, 2).Return([]*model.User{{ID: "c"}}, nil).Once()
+
+		purged, err := NewPurger(repository, cfg).Purge(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 3, purged)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("repository fails", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("Purge", context.Background(), deletedBefore, 2).Return([]*model.User{{ID: "a"}, {ID: "b"}}, nil).Once()
+		repository.On("Purge", context.Background(), deletedBefore, 2).Return(nil, assert.AnError).Once()
+
+		purged, err := NewPurger(repository, cfg).Purge(context.Background())
+		assert.Equal(t, assert.AnError, err)
+		assert.Equal(t, 2, purged)
+	})
+}
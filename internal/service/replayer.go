@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+)
+
+// ReplayerConfig configures which users are replayed and how fast
+type ReplayerConfig struct {
+	// Country replays only the users from that country, if provided
+	Country string
+	// UpdatedSince replays only the users updated since then, if provided
+	UpdatedSince time.Time
+	// BatchSize is the maximum amount of users retrieved at once
+	BatchSize int
+	// Rate is the maximum amount of users published per second, 0 means no limit
+	Rate int
+}
+
+// Replayer publishes the existing users, so new consumers can learn about them
+type Replayer struct {
+	repo    persistence.Repository
+	publish func(context.Context, *model.User) error
+	cfg     ReplayerConfig
+}
+
+// NewReplayer provides a Replayer that publishes each user using the publish func provided
+func NewReplayer(repo persistence.Repository, publish func(context.Context, *model.User) error, cfg ReplayerConfig) *Replayer {
+	return &Replayer{
+		repo:    repo,
+		publish: publish,
+		cfg:     cfg,
+	}
+}
+
+// Replay publishes the users sorted by ID, starting after afterID (or from the first one if empty).
+// The ID of the last published user is provided to the progress func after each batch, so the replay can be resumed from there.
+// It returns how many users were published.
+func (r *Replayer) Replay(ctx context.Context, afterID string, progress func(lastID string) error) (int, error) {
+	var tick <-chan time.Time
+	if r.cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(r.cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var published int
+	for {
+		users, err := r.list(ctx, afterID)
+		if err != nil {
+			return published, err
+		}
+
+		for _, u := range users {
+			// users are filtered here as there's no index for the updated_at column
+			if u.UpdatedAt.Before(r.cfg.UpdatedSince) {
+				continue
+			}
+
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					return published, ctx.Err()
+				case <-tick:
+				}
+			}
+
+			if err := r.publish(ctx, u); err != nil {
+				return published, err
+			}
+			published++
+		}
+
+		if len(users) == 0 {
+			return published, nil
+		}
+
+		afterID = users[len(users)-1].ID
+		if err := progress(afterID); err != nil {
+			return published, err
+		}
+
+		if len(users) < r.cfg.BatchSize {
+			return published, nil
+		}
+	}
+}
+
+func (r *Replayer) list(ctx context.Context, afterID string) ([]*model.User, error) {
+	if r.cfg.Country != "" {
+		return r.repo.ListCountryAfter(ctx, r.cfg.Country, afterID, r.cfg.BatchSize, false)
+	}
+	return r.repo.ListAllAfter(ctx, afterID, r.cfg.BatchSize, false)
+}
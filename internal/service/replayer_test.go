@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence/persistencemock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayer_Replay(t *testing.T) {
+	someUser := func(id string, updatedAt time.Time) *model.User {
+		return &model.User{ID: id, UpdatedAt: updatedAt}
+	}
+
+	t.Run("replays in batches from the provided ID", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("ListAllAfter", context.Background(), "a", 2, false).Return([]*model.User{someUser("b", mockedNow), someUser("c", mockedNow)}, nil).Once()
+		repository.On("ListAllAfter", context.Background(), "c", 2, false).Return([]*model.User{someUser("d", mockedNow)}, nil).Once()
+
+		var published, progress []string
+		publish := func(_ context.Context, u *model.User) error {
+			published = append(published, u.ID)
+			return nil
+		}
+
+		replayer := NewReplayer(repository, publish, ReplayerConfig{BatchSize: 2})
+		replayed, err := replayer.Replay(context.Background(), "a", func(lastID string) error {
+			progress = append(progress, lastID)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, replayed)
+		assert.Equal(t, []string{"b", "c", "d"}, published)
+		assert.Equal(t, []string{"c", "d"}, progress)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("filters by country and updated since", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("ListCountryAfter", context.Background(), "es", "", 2, false).Return([]*model.User{someUser("a", mockedNow.Add(-time.Hour)), someUser("b", mockedNow)}, nil).Once()
+		repository.On("ListCountryAfter", context.Background(), "es", "b", 2, false).Return(nil, nil).Once()
+
+		var published []string
+		publish := func(_ context.Context, u *model.User) error {
+			published = append(published, u.ID)
+			return nil
+		}
+
+		replayer := NewReplayer(repository, publish, ReplayerConfig{Country: "es", UpdatedSince: mockedNow, BatchSize: 2})
+		replayed, err := replayer.Replay(context.Background(), "", func(string) error { return nil })
+		assert.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+		assert.Equal(t, []string{"b"}, published)
+	})
+
+	t.Run("publishing fails", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("ListAllAfter", context.Background(), "", 2, false).Return([]*model.User{someUser("a", mockedNow), someUser("b", mockedNow)}, nil).Once()
+
+		publish := func(_ context.Context, u *model.User) error {
+			if u.ID == "b" {
+				return assert.AnError
+			}
+			return nil
+		}
+
+		replayer := NewReplayer(repository, publish, ReplayerConfig{BatchSize: 2})
+		replayed, err := replayer.Replay(context.Background(), "", func(string) error {
+			t.Fatal("Progress shouldn't be stored for a failed batch")
+			return nil
+		})
+		assert.Equal(t, assert.AnError, err)
+		assert.Equal(t, 1, replayed)
+	})
+}
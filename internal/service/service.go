@@ -2,29 +2,69 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/a-faceit-candidate/userservice/internal/log"
 	"github.com/a-faceit-candidate/userservice/internal/model"
 	"github.com/a-faceit-candidate/userservice/internal/persistence"
+	"github.com/a-faceit-candidate/userservice/internal/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/a-faceit-candidate/userservice/internal/service")
+
+// startSpan starts the span of a ServiceImpl method, as the parent of the repository spans
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "ServiceImpl."+method)
+}
+
 // Service describes the functionality of the business logic in this service
 type Service interface {
 	// Create assumes that ID, CreatedAt, and UpdatedAt fields are empty.
 	// Create will modify the user provided.
+	// None of the users returned by the service contain the PasswordHash and PasswordSalt, except for ExportCredentials.
 	Create(context.Context, *model.User) (*model.User, error)
 	// Update will modify the user provided updating the UpdatedAt timestamp, and the ID will be set to the one provided
 	Update(ctx context.Context, id string, user *model.User) (*model.User, error)
+	// Patch applies the provided changes to the user with given ID, updating the UpdatedAt timestamp.
+	// If patch.UpdatedAt is provided and it differs from the stored one, it fails with ErrConflict.
+	Patch(ctx context.Context, id string, patch *model.UserPatch) (*model.User, error)
 	Get(context.Context, string) (*model.User, error)
+	// GetByEmail retrieves the user with the given email, the comparison is case-insensitive.
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// ExportCredentials retrieves the user including its PasswordHash and PasswordSalt.
+	// This is a privileged operation intended for migrating the users to another system, not for regular reads.
+	ExportCredentials(ctx context.Context, id string) (*model.User, error)
+	// Delete marks the user as deleted, it can be restored until it's purged after the retention period.
 	Delete(context.Context, string) error
-	ListAll(context.Context) ([]*model.User, error)
-	ListCountry(ctx context.Context, countryCode string) ([]*model.User, error)
+	// DeleteVersioned deletes the user with the given ID if its UpdatedAt is still prevUpdatedAt,
+	// otherwise it fails with ErrConflict, like Update does.
+	DeleteVersioned(ctx context.Context, id string, prevUpdatedAt time.Time) error
+	// Restore unmarks the user as deleted, updating its UpdatedAt timestamp.
+	// It fails with ErrNotFound if there's no deleted user with that ID.
+	Restore(ctx context.Context, id string) (*model.User, error)
+	// Erase permanently deletes the user, even if it was already deleted, so it can't be restored.
+	// It's intended for the erasure requests, like the GDPR ones, not for regular deletions.
+	Erase(ctx context.Context, id string) error
+	// ListAll retrieves all the users, the deleted ones are only included if includeDeleted is true.
+	ListAll(ctx context.Context, includeDeleted bool) ([]*model.User, error)
+	ListCountry(ctx context.Context, countryCode string, includeDeleted bool) ([]*model.User, error)
+	// VerifyPassword checks whether the password provided matches the one of the user with given ID.
+	VerifyPassword(ctx context.Context, id, password string) (bool, error)
+	// VerifyPasswordByEmail checks whether the password provided matches the one of the user with given email.
+	// An unknown email is reported as a mismatch rather than ErrNotFound, so it can't be used to enumerate users.
+	VerifyPasswordByEmail(ctx context.Context, email, password string) (bool, error)
+	// ListAllPage retrieves up to limit users starting at the provided opaque cursor, an empty cursor means first page.
+	// A zero limit means DefaultPageLimit. Returned nextCursor is empty when there are no more users to retrieve.
+	ListAllPage(ctx context.Context, cursor string, limit int, includeDeleted bool) (users []*model.User, nextCursor string, err error)
+	// ListCountryPage is the paginated version of ListCountry, it works like ListAllPage.
+	ListCountryPage(ctx context.Context, countryCode, cursor string, limit int, includeDeleted bool) (users []*model.User, nextCursor string, err error)
 }
 
 //go:generate mockery -output servicemock -outpkg servicemock -case underscore -name Service
@@ -32,20 +72,39 @@ type Service interface {
 var ErrNotFound = errors.New("not found")
 var ErrConflict = errors.New("conflict updating")
 
+// ErrEmailInUse is returned when the email of the user being created or updated already belongs to another user
+var ErrEmailInUse = errors.New("email already in use")
+
+// ErrEmailOfDeletedUser is returned when the email of the user being created or updated belongs to a deleted user,
+// which keeps it until it's purged, so it should be restored instead
+var ErrEmailOfDeletedUser = errors.New("email belongs to a deleted user, which can be restored until it's purged")
+
+const (
+	// DefaultPageLimit is the amount of users returned per page when no limit is requested
+	DefaultPageLimit = 100
+	// MaxPageLimit is the maximum amount of users that can be requested in a single page
+	MaxPageLimit = 1000
+)
+
 // ErrInvalidParams won't be returned itself, but it will be wrapped by another error instead
 // this is a shorthand to implemeting an own error type
 var ErrInvalidParams = errors.New("invalid params")
 
 // New provices an implementation of Service
-func New(repo persistence.Repository) *ServiceImpl {
+func New(repo persistence.Repository, hasher PasswordHasher) *ServiceImpl {
 	return &ServiceImpl{
-		repo: repo,
+		repo:   repo,
+		hasher: hasher,
 	}
 }
 
 // ServiceImpl is the default, and hopefully unique implementation of the service.
 type ServiceImpl struct {
-	repo persistence.Repository
+	repo   persistence.Repository
+	hasher PasswordHasher
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
 // Create will fill the ID, CreatedAt and Updated at fields of the user before creating it
@@ -53,11 +112,16 @@ type ServiceImpl struct {
 // Notice that the timestamps have to be truncated to the microsecond, as that's the best precision mysql suports on the
 // DATETIME field. Otherwise we'd be returning to the caller timestamp with more precision than stored, and they wouldn't
 // be able to update the model using those timestamps later.
-func (s *ServiceImpl) Create(ctx context.Context, user *model.User) (*model.User, error) {
+func (s *ServiceImpl) Create(ctx context.Context, user *model.User) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Create")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	if err := s.validateUserForCreate(user); err != nil {
 		return nil, err
 	}
-	s.replacePasswordByHash(user)
+	if err := s.replacePasswordByHash(user); err != nil {
+		return nil, err
+	}
 
 	user.ID = uuidv1()
 	user.CreatedAt = timeNow().Truncate(time.Microsecond)
@@ -67,65 +131,265 @@ func (s *ServiceImpl) Create(ctx context.Context, user *model.User) (*model.User
 		if err == persistence.ErrConflict {
 			// repository did it okay, but we failed at uniqueness
 			return nil, fmt.Errorf("internal error: we've generated a duplicated uuid")
+		} else if err == persistence.ErrDuplicateEmail {
+			return nil, ErrEmailInUse
+		} else if err == persistence.ErrDuplicateEmailOfDeletedUser {
+			return nil, ErrEmailOfDeletedUser
 		}
 		return nil, err
 	}
 
-	return user, nil
+	return withoutPassword(user), nil
 }
 
-func (s *ServiceImpl) Update(ctx context.Context, id string, user *model.User) (*model.User, error) {
+func (s *ServiceImpl) Update(ctx context.Context, id string, user *model.User) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Update")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	if err := s.validateUserForUpdate(user); err != nil {
 		return nil, err
 	}
 	if user.Password != "" {
-		s.replacePasswordByHash(user)
+		if err := s.replacePasswordByHash(user); err != nil {
+			return nil, err
+		}
 	}
 
 	providedUpdatedAt := user.UpdatedAt
 	user.ID = id
 	user.UpdatedAt = timeNow().Truncate(time.Microsecond)
 
-	if err := s.repo.Update(ctx, user, providedUpdatedAt); err != nil {
+	if err := s.update(ctx, user, providedUpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return withoutPassword(user), nil
+}
+
+// Patch retrieves the current user and updates it with the patch applied.
+// The retrieved UpdatedAt is used as the expected one when updating, so if the user is modified between both
+// operations, it fails with ErrConflict, like Update does.
+func (s *ServiceImpl) Patch(ctx context.Context, id string, patch *model.UserPatch) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Patch")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	prevUpdatedAt := user.UpdatedAt
+	if !patch.UpdatedAt.IsZero() && !patch.UpdatedAt.Equal(prevUpdatedAt) {
+		return nil, ErrConflict
+	}
+	if patch.Password != nil && *patch.Password == "" {
+		// validateUserForUpdate would consider this as not updating the password
+		return nil, fmt.Errorf("%w: password can't be empty", ErrInvalidParams)
+	}
+
+	applyPatch(user, patch)
+	if err := s.validateUserForUpdate(user); err != nil {
+		return nil, err
+	}
+	if user.Password != "" {
+		if err := s.replacePasswordByHash(user); err != nil {
+			return nil, err
+		}
+	}
+
+	user.UpdatedAt = timeNow().Truncate(time.Microsecond)
+
+	if err := s.update(ctx, user, prevUpdatedAt); err != nil {
+		return nil, err
+	}
+
+	return withoutPassword(user), nil
+}
+
+func (s *ServiceImpl) update(ctx context.Context, user *model.User, prevUpdatedAt time.Time) error {
+	if _, err := s.repo.Update(ctx, user, prevUpdatedAt); err != nil {
 		if err == persistence.ErrConflict {
-			return nil, ErrConflict
+			return ErrConflict
 		} else if err == persistence.ErrNotFound {
-			return nil, ErrNotFound
+			return ErrNotFound
+		} else if err == persistence.ErrDuplicateEmail {
+			return ErrEmailInUse
+		} else if err == persistence.ErrDuplicateEmailOfDeletedUser {
+			return ErrEmailOfDeletedUser
 		}
-		return nil, err
+		return err
 	}
+	return nil
+}
 
+func (s *ServiceImpl) Get(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Get")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return mapNotFound(s.repo.Get(ctx, id))
+}
+
+func (s *ServiceImpl) GetByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "GetByEmail")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return mapNotFound(s.repo.GetByEmail(ctx, email))
+}
+
+func (s *ServiceImpl) ExportCredentials(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "ExportCredentials")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	user, err := mapNotFound(s.repo.GetCredentials(ctx, id))
+	if err != nil {
+		return nil, err
+	}
+	log.For(ctx).Warning("User credentials were exported")
 	return user, nil
 }
 
-func (s *ServiceImpl) Get(ctx context.Context, id string) (*model.User, error) {
-	user, err := s.repo.Get(ctx, id)
+func (s *ServiceImpl) VerifyPassword(ctx context.Context, id, password string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "VerifyPassword")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	user, err := mapNotFound(s.repo.GetCredentials(ctx, id))
+	if err != nil {
+		return false, err
+	}
+	return s.passwordMatches(ctx, user, password)
+}
+
+func (s *ServiceImpl) VerifyPasswordByEmail(ctx context.Context, email, password string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "VerifyPasswordByEmail")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	user, err := s.repo.GetCredentialsByEmail(ctx, email)
+	if err == persistence.ErrNotFound {
+		// verify against a throwaway hash so an unknown email takes as long as a wrong password
+		s.verifyDummyHash(password)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return s.passwordMatches(ctx, user, password)
+}
+
+func (s *ServiceImpl) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "Delete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	_, err = s.repo.Delete(ctx, id, timeNow().Truncate(time.Microsecond))
+	if err != nil {
+		if err == persistence.ErrNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ServiceImpl) DeleteVersioned(ctx context.Context, id string, prevUpdatedAt time.Time) (err error) {
+	ctx, span := startSpan(ctx, "DeleteVersioned")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	_, err = s.repo.DeleteVersioned(ctx, id, prevUpdatedAt, timeNow().Truncate(time.Microsecond))
+	if err != nil {
+		if err == persistence.ErrNotFound {
+			return ErrNotFound
+		} else if err == persistence.ErrConflict {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *ServiceImpl) Restore(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := startSpan(ctx, "Restore")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	err = s.repo.Restore(ctx, id, timeNow().Truncate(time.Microsecond))
 	if err != nil {
 		if err == persistence.ErrNotFound {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return user, nil
+	return s.Get(ctx, id)
 }
 
-func (s *ServiceImpl) Delete(ctx context.Context, id string) error {
-	err := s.repo.Delete(ctx, id)
-	if err != nil {
+func (s *ServiceImpl) Erase(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "Erase")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	if _, err := s.repo.Erase(ctx, id); err != nil {
 		if err == persistence.ErrNotFound {
 			return ErrNotFound
 		}
 		return err
 	}
+	log.For(ctx).Infof("User %s was erased", id)
 	return nil
 }
 
-func (s *ServiceImpl) ListAll(ctx context.Context) ([]*model.User, error) {
-	return s.removePasswords(s.repo.ListAll(ctx))
+func (s *ServiceImpl) ListAll(ctx context.Context, includeDeleted bool) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "ListAll")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return s.removePasswords(s.repo.ListAll(ctx, includeDeleted))
+}
+
+func (s *ServiceImpl) ListCountry(ctx context.Context, countryCode string, includeDeleted bool) (_ []*model.User, err error) {
+	ctx, span := startSpan(ctx, "ListCountry")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return s.removePasswords(s.repo.ListCountry(ctx, countryCode, includeDeleted))
+}
+
+func (s *ServiceImpl) ListAllPage(ctx context.Context, cursor string, limit int, includeDeleted bool) (_ []*model.User, _ string, err error) {
+	ctx, span := startSpan(ctx, "ListAllPage")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return s.listPage(cursor, limit, func(afterID string, limit int) ([]*model.User, error) {
+		return s.repo.ListAllAfter(ctx, afterID, limit, includeDeleted)
+	})
 }
 
-func (s *ServiceImpl) ListCountry(ctx context.Context, countryCode string) ([]*model.User, error) {
-	return s.removePasswords(s.repo.ListCountry(ctx, countryCode))
+func (s *ServiceImpl) ListCountryPage(ctx context.Context, countryCode, cursor string, limit int, includeDeleted bool) (_ []*model.User, _ string, err error) {
+	ctx, span := startSpan(ctx, "ListCountryPage")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	return s.listPage(cursor, limit, func(afterID string, limit int) ([]*model.User, error) {
+		return s.repo.ListCountryAfter(ctx, countryCode, afterID, limit, includeDeleted)
+	})
+}
+
+// listPage validates the pagination params and retrieves the page using the provided list func
+// We request one user more than the limit to know whether there's a next page or not, so we don't return a cursor
+// to an empty page.
+func (s *ServiceImpl) listPage(cursor string, limit int, list func(afterID string, limit int) ([]*model.User, error)) ([]*model.User, string, error) {
+	if limit == 0 {
+		limit = DefaultPageLimit
+	}
+	if limit < 0 || limit > MaxPageLimit {
+		return nil, "", fmt.Errorf("%w: limit should be between 1 and %d, got %d", ErrInvalidParams, MaxPageLimit, limit)
+	}
+
+	afterID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	users, err := s.removePasswords(list(afterID, limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	users = users[:limit]
+	return users, encodeCursor(users[limit-1].ID), nil
 }
 
 func (s *ServiceImpl) validateUserForCreate(user *model.User) error {
@@ -185,12 +449,106 @@ func (s *ServiceImpl) validateUser(user *model.User) error {
 	return nil
 }
 
-func (s *ServiceImpl) replacePasswordByHash(user *model.User) {
-	user.PasswordSalt = randomSalt()
-	salted := user.Password + user.PasswordSalt
-	hashArray := sha256.Sum256([]byte(salted))
-	user.PasswordHash = hex.EncodeToString(hashArray[:])
+func (s *ServiceImpl) replacePasswordByHash(user *model.User) error {
+	hash, err := s.hasher.Hash(user.Password)
+	if err != nil {
+		return fmt.Errorf("can't hash password: %w", err)
+	}
+	user.PasswordHash = hash
+	user.PasswordSalt = ""
 	user.Password = ""
+	return nil
+}
+
+// passwordMatches checks the password against the user's hash.
+// Hashes generated by previous versions of this service have a separate salt, and they're verified using the legacy
+// algorithm. Once a password is successfully verified, if its hash isn't generated with the current algorithm and
+// params, it's replaced with a new one. Failing to do so isn't an error as we'll just try again next time.
+func (s *ServiceImpl) passwordMatches(ctx context.Context, user *model.User, password string) (bool, error) {
+	if user.PasswordHash == "" {
+		return false, nil
+	}
+
+	var match, legacy bool
+	if user.PasswordSalt != "" {
+		legacy = true
+		match = legacyPasswordMatches(password, user.PasswordHash, user.PasswordSalt)
+	} else {
+		var err error
+		match, err = s.hasher.Verify(password, user.PasswordHash)
+		if err != nil {
+			return false, fmt.Errorf("can't verify password: %w", err)
+		}
+	}
+
+	if match && (legacy || s.hasher.NeedsRehash(user.PasswordHash)) {
+		s.rehashPassword(ctx, user, password)
+	}
+	return match, nil
+}
+
+// verifyDummyHash spends the same time verifying the password as passwordMatches would for a stored hash.
+// The dummy hash is computed lazily with the current hasher params, so it costs as much as the real ones.
+func (s *ServiceImpl) verifyDummyHash(password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.hasher.Hash(uuid.New().String())
+	})
+	if s.dummyHash != "" {
+		_, _ = s.hasher.Verify(password, s.dummyHash)
+	}
+}
+
+func (s *ServiceImpl) rehashPassword(ctx context.Context, user *model.User, password string) {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.For(ctx).Warningf("Can't rehash password: %s", err)
+		return
+	}
+	if err := s.repo.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, hash); err != nil {
+		log.For(ctx).Warningf("Can't store rehashed password: %s", err)
+		return
+	}
+	log.For(ctx).Info("Password was rehashed")
+}
+
+func applyPatch(user *model.User, patch *model.UserPatch) {
+	if patch.FirstName != nil {
+		user.FirstName = *patch.FirstName
+	}
+	if patch.LastName != nil {
+		user.LastName = *patch.LastName
+	}
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		user.Email = *patch.Email
+	}
+	if patch.Password != nil {
+		user.Password = *patch.Password
+	}
+	if patch.Country != nil {
+		user.Country = *patch.Country
+	}
+}
+
+// mapNotFound maps the persistence.ErrNotFound returned when retrieving a single user
+func mapNotFound(user *model.User, err error) (*model.User, error) {
+	if err == persistence.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// withoutPassword provides a copy of the user without the password, its hash or salt, so they don't leave the service
+func withoutPassword(user *model.User) *model.User {
+	cpy := *user
+	cpy.Password = ""
+	cpy.PasswordHash = ""
+	cpy.PasswordSalt = ""
+	return &cpy
 }
 
 func (s *ServiceImpl) removePasswords(users []*model.User, err error) ([]*model.User, error) {
@@ -204,6 +562,24 @@ func (s *ServiceImpl) removePasswords(users []*model.User, err error) ([]*model.
 	return users, nil
 }
 
+// encodeCursor builds an opaque cursor pointing after the provided user ID.
+// Cursors are opaque to the clients so we can change the pagination strategy without breaking them.
+func encodeCursor(lastID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(lastID))
+}
+
+// decodeCursor returns the user ID encoded in the cursor, or an empty string if the cursor is empty
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	lastID, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(lastID) == 0 {
+		return "", fmt.Errorf("%w: invalid cursor", ErrInvalidParams)
+	}
+	return string(lastID), nil
+}
+
 var timeNow = func() time.Time {
 	return time.Now()
 }
@@ -211,12 +587,3 @@ var timeNow = func() time.Time {
 var uuidv1 = func() string {
 	return uuid.Must(uuid.NewUUID()).String()
 }
-
-var randomSalt = func() string {
-	saltBytes := make([]byte, 16)
-	if _, err := rand.Read(saltBytes); err != nil {
-		// this should be enough reason to panic
-		panic(fmt.Errorf("can't read random bytes: %w", err))
-	}
-	return hex.EncodeToString(saltBytes)
-}
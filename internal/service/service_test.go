@@ -2,14 +2,21 @@ package service
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
 	"github.com/a-faceit-candidate/userservice/internal/persistence/persistencemock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var (
@@ -17,10 +24,35 @@ var (
 	mockedUUID   = "123e4567-e89b-12d3-a456-426614174000"
 	mockedSalt   = "1234567890abcdef1234567890abcdef"
 	somePassword = "password"
-	// someHashedPassword is calculated running 'echo -n "password1234567890abcdef1234567890abcdef" | sha256sum'
-	someHashedPassword = "c1406c11bb520b4f012aa0e95d4704d0001e75ee0d43baa8e8af69ce5616cea2"
+	// someLegacyHashedPassword is calculated running 'echo -n "password1234567890abcdef1234567890abcdef" | sha256sum'
+	someLegacyHashedPassword = "c1406c11bb520b4f012aa0e95d4704d0001e75ee0d43baa8e8af69ce5616cea2"
+	someHashedPassword       = fakeHasher{}.hash(somePassword)
+	// spanRecorder records the spans of all the tests, the tracers only use the first provider set
+	spanRecorder = tracetest.NewSpanRecorder()
 )
 
+// endedSpans returns the spans ended by f
+func endedSpans(f func()) []sdktrace.ReadOnlySpan {
+	before := len(spanRecorder.Ended())
+	f()
+	return spanRecorder.Ended()[before:]
+}
+
+// fakeHasher is a PasswordHasher that provides predictable hashes, the real ones are tested in password_test.go
+type fakeHasher struct {
+	needsRehash bool
+}
+
+func (fakeHasher) hash(password string) string { return "$fake$" + password }
+
+func (h fakeHasher) Hash(password string) (string, error) { return h.hash(password), nil }
+
+func (h fakeHasher) Verify(password, encodedHash string) (bool, error) {
+	return h.hash(password) == encodedHash, nil
+}
+
+func (h fakeHasher) NeedsRehash(string) bool { return h.needsRehash }
+
 func TestMain(t *testing.M) {
 	// mocking for poor people happens here.
 	// we could also build a test suite
@@ -28,7 +60,7 @@ func TestMain(t *testing.M) {
 	// all are valid options, I chose this one
 	timeNow = func() time.Time { return mockedNow }
 	uuidv1 = func() string { return mockedUUID }
-	randomSalt = func() string { return mockedSalt }
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
 	os.Exit(t.Run())
 }
 
@@ -45,7 +77,6 @@ func TestServiceImpl_Create(t *testing.T) {
 		expectedRepositoryUser := user
 		expectedRepositoryUser.ID = mockedUUID
 		expectedRepositoryUser.PasswordHash = someHashedPassword
-		expectedRepositoryUser.PasswordSalt = mockedSalt
 		expectedRepositoryUser.Password = ""
 
 		expectedRepositoryUser.CreatedAt = mockedNow.Truncate(time.Microsecond)
@@ -54,11 +85,52 @@ func TestServiceImpl_Create(t *testing.T) {
 		repository := &persistencemock.Repository{}
 		repository.On("Create", mock.Anything, &expectedRepositoryUser).Return(nil)
 
-		svc := New(repository)
+		svc := New(repository, fakeHasher{})
+
+		expectedResponseUser := expectedRepositoryUser
+		expectedResponseUser.PasswordHash = ""
 
 		got, err := svc.Create(context.Background(), &user)
 		assert.NoError(t, err)
-		assert.Equal(t, &expectedRepositoryUser, got)
+		assert.Equal(t, &expectedResponseUser, got)
+	})
+
+	t.Run("email in use", func(t *testing.T) {
+		user := model.User{
+			FirstName: "first",
+			LastName:  "last",
+			Name:      "foo",
+			Email:     "bar@hotmail.com",
+			Password:  somePassword,
+			Country:   "zz",
+		}
+
+		repository := &persistencemock.Repository{}
+		repository.On("Create", mock.Anything, mock.Anything).Return(persistence.ErrDuplicateEmail)
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.Create(context.Background(), &user)
+		assert.Equal(t, ErrEmailInUse, err)
+	})
+
+	t.Run("email of deleted user", func(t *testing.T) {
+		user := model.User{
+			FirstName: "first",
+			LastName:  "last",
+			Name:      "foo",
+			Email:     "bar@hotmail.com",
+			Password:  somePassword,
+			Country:   "zz",
+		}
+
+		repository := &persistencemock.Repository{}
+		repository.On("Create", mock.Anything, mock.Anything).Return(persistence.ErrDuplicateEmailOfDeletedUser)
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.Create(context.Background(), &user)
+		assert.Equal(t, ErrEmailOfDeletedUser, err)
 	})
 
 	t.Run("invalid user params", func(t *testing.T) {
@@ -110,6 +182,283 @@ func TestServiceImpl_Create(t *testing.T) {
 	})
 }
 
+func TestServiceImpl_Patch(t *testing.T) {
+	storedUpdatedAt := mockedNow.Add(-time.Hour).Truncate(time.Microsecond)
+	storedUser := func() *model.User {
+		return &model.User{
+			ID:        mockedUUID,
+			CreatedAt: storedUpdatedAt,
+			UpdatedAt: storedUpdatedAt,
+			FirstName: "first",
+			LastName:  "last",
+			Name:      "foo",
+			Email:     "bar@hotmail.com",
+			Country:   "zz",
+		}
+	}
+	someCountry := "es"
+
+	t.Run("happy case", func(t *testing.T) {
+		expectedRepositoryUser := storedUser()
+		expectedRepositoryUser.Country = someCountry
+		expectedRepositoryUser.UpdatedAt = mockedNow.Truncate(time.Microsecond)
+
+		repository := &persistencemock.Repository{}
+		repository.On("Get", mock.Anything, mockedUUID).Return(storedUser(), nil)
+		repository.On("Update", mock.Anything, expectedRepositoryUser, storedUpdatedAt).Return(storedUser(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		got, err := svc.Patch(context.Background(), mockedUUID, &model.UserPatch{Country: &someCountry})
+		assert.NoError(t, err)
+		assert.Equal(t, expectedRepositoryUser, got)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("password is hashed", func(t *testing.T) {
+		expectedRepositoryUser := storedUser()
+		expectedRepositoryUser.PasswordHash = someHashedPassword
+		expectedRepositoryUser.UpdatedAt = mockedNow.Truncate(time.Microsecond)
+
+		repository := &persistencemock.Repository{}
+		repository.On("Get", mock.Anything, mockedUUID).Return(storedUser(), nil)
+		repository.On("Update", mock.Anything, expectedRepositoryUser, storedUpdatedAt).Return(storedUser(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		got, err := svc.Patch(context.Background(), mockedUUID, &model.UserPatch{Password: &somePassword})
+		assert.NoError(t, err)
+		assert.Empty(t, got.PasswordHash)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("expected updated at differs", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("Get", mock.Anything, mockedUUID).Return(storedUser(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.Patch(context.Background(), mockedUUID, &model.UserPatch{UpdatedAt: storedUpdatedAt.Add(time.Second), Country: &someCountry})
+		assert.Equal(t, ErrConflict, err)
+		repository.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid result", func(t *testing.T) {
+		invalidCountry := "zzz"
+
+		repository := &persistencemock.Repository{}
+		repository.On("Get", mock.Anything, mockedUUID).Return(storedUser(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.Patch(context.Background(), mockedUUID, &model.UserPatch{Country: &invalidCountry})
+		assert.True(t, errors.Is(err, ErrInvalidParams))
+	})
+
+	t.Run("concurrent update", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("Get", mock.Anything, mockedUUID).Return(storedUser(), nil)
+		repository.On("Update", mock.Anything, mock.Anything, storedUpdatedAt).Return(nil, persistence.ErrConflict)
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.Patch(context.Background(), mockedUUID, &model.UserPatch{Country: &someCountry})
+		assert.Equal(t, ErrConflict, err)
+	})
+
+	t.Run("traced", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("Get", mock.Anything, mockedUUID).Return(storedUser(), nil)
+		repository.On("Update", mock.Anything, mock.Anything, storedUpdatedAt).Return(nil, persistence.ErrConflict)
+
+		svc := New(repository, fakeHasher{})
+
+		spans := endedSpans(func() {
+			_, err := svc.Patch(context.Background(), mockedUUID, &model.UserPatch{Country: &someCountry})
+			assert.Equal(t, ErrConflict, err)
+		})
+		require.Len(t, spans, 2)
+		get, patch := spans[0], spans[1]
+		assert.Equal(t, "ServiceImpl.Get", get.Name())
+		assert.Equal(t, "ServiceImpl.Patch", patch.Name())
+		assert.Equal(t, patch.SpanContext().SpanID(), get.Parent().SpanID())
+		assert.Equal(t, codes.Error, patch.Status().Code)
+		assert.Equal(t, ErrConflict.Error(), patch.Status().Description)
+	})
+}
+
+func TestServiceImpl_VerifyPassword(t *testing.T) {
+	storedUser := func() *model.User {
+		return &model.User{ID: mockedUUID, PasswordHash: someHashedPassword}
+	}
+	legacyUser := func() *model.User {
+		return &model.User{ID: mockedUUID, PasswordHash: someLegacyHashedPassword, PasswordSalt: mockedSalt}
+	}
+
+	t.Run("match", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentials", mock.Anything, mockedUUID).Return(storedUser(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		match, err := svc.VerifyPassword(context.Background(), mockedUUID, somePassword)
+		assert.NoError(t, err)
+		assert.True(t, match)
+		repository.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentials", mock.Anything, mockedUUID).Return(storedUser(), nil)
+
+		svc := New(repository, fakeHasher{needsRehash: true})
+
+		match, err := svc.VerifyPassword(context.Background(), mockedUUID, "wrong password")
+		assert.NoError(t, err)
+		assert.False(t, match)
+		repository.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("match with outdated params is rehashed", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentials", mock.Anything, mockedUUID).Return(storedUser(), nil)
+		repository.On("UpdatePasswordHash", mock.Anything, mockedUUID, someHashedPassword, someHashedPassword).Return(nil)
+
+		svc := New(repository, fakeHasher{needsRehash: true})
+
+		match, err := svc.VerifyPassword(context.Background(), mockedUUID, somePassword)
+		assert.NoError(t, err)
+		assert.True(t, match)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("legacy hash match is rehashed", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentials", mock.Anything, mockedUUID).Return(legacyUser(), nil)
+		repository.On("UpdatePasswordHash", mock.Anything, mockedUUID, someLegacyHashedPassword, someHashedPassword).Return(errors.New("can't update"))
+
+		svc := New(repository, fakeHasher{})
+
+		match, err := svc.VerifyPassword(context.Background(), mockedUUID, somePassword)
+		assert.NoError(t, err, "failing to rehash shouldn't fail the verification")
+		assert.True(t, match)
+		repository.AssertExpectations(t)
+	})
+
+	t.Run("legacy hash no match", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentials", mock.Anything, mockedUUID).Return(legacyUser(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		match, err := svc.VerifyPassword(context.Background(), mockedUUID, "wrong password")
+		assert.NoError(t, err)
+		assert.False(t, match)
+		repository.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentials", mock.Anything, mockedUUID).Return(nil, persistence.ErrNotFound)
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.VerifyPassword(context.Background(), mockedUUID, somePassword)
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestServiceImpl_VerifyPasswordByEmail(t *testing.T) {
+	t.Run("match", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentialsByEmail", mock.Anything, "foo@example.com").Return(&model.User{ID: mockedUUID, PasswordHash: someHashedPassword}, nil)
+
+		svc := New(repository, fakeHasher{})
+
+		match, err := svc.VerifyPasswordByEmail(context.Background(), "foo@example.com", somePassword)
+		assert.NoError(t, err)
+		assert.True(t, match)
+	})
+
+	t.Run("unknown email is just a mismatch", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentialsByEmail", mock.Anything, "foo@example.com").Return(nil, persistence.ErrNotFound)
+
+		hasher := &countingHasher{}
+		svc := New(repository, hasher)
+
+		match, err := svc.VerifyPasswordByEmail(context.Background(), "foo@example.com", somePassword)
+		assert.NoError(t, err)
+		assert.False(t, match)
+		assert.Equal(t, 1, hasher.verified, "a hash should be verified anyway so timing doesn't reveal unknown emails")
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("GetCredentialsByEmail", mock.Anything, "foo@example.com").Return(nil, errors.New("boom"))
+
+		svc := New(repository, fakeHasher{})
+
+		_, err := svc.VerifyPasswordByEmail(context.Background(), "foo@example.com", somePassword)
+		assert.Error(t, err)
+	})
+}
+
+// countingHasher is a fakeHasher that counts the verifications performed
+type countingHasher struct {
+	fakeHasher
+	verified int
+}
+
+func (h *countingHasher) Verify(password, encodedHash string) (bool, error) {
+	h.verified++
+	return h.fakeHasher.Verify(password, encodedHash)
+}
+
+func TestServiceImpl_ListAllPage(t *testing.T) {
+	someUsers := func() []*model.User {
+		return []*model.User{
+			{ID: "a", PasswordHash: "hash", PasswordSalt: "salt"},
+			{ID: "b", PasswordHash: "hash", PasswordSalt: "salt"},
+			{ID: "c", PasswordHash: "hash", PasswordSalt: "salt"},
+		}
+	}
+
+	t.Run("first page with more pages", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("ListAllAfter", mock.Anything, "", 3, false).Return(someUsers(), nil)
+
+		svc := New(repository, fakeHasher{})
+
+		users, nextCursor, err := svc.ListAllPage(context.Background(), "", 2, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.User{{ID: "a"}, {ID: "b"}}, users)
+		assert.Equal(t, encodeCursor("b"), nextCursor)
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		repository := &persistencemock.Repository{}
+		repository.On("ListAllAfter", mock.Anything, "b", DefaultPageLimit+1, false).Return(someUsers()[2:], nil)
+
+		svc := New(repository, fakeHasher{})
+
+		users, nextCursor, err := svc.ListAllPage(context.Background(), encodeCursor("b"), 0, false)
+		assert.NoError(t, err)
+		assert.Equal(t, []*model.User{{ID: "c"}}, users)
+		assert.Empty(t, nextCursor)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		svc := New(&persistencemock.Repository{}, fakeHasher{})
+
+		_, _, err := svc.ListAllPage(context.Background(), "", MaxPageLimit+1, false)
+		assert.True(t, errors.Is(err, ErrInvalidParams))
+
+		_, _, err = svc.ListAllPage(context.Background(), "not a cursor!", 10, false)
+		assert.True(t, errors.Is(err, ErrInvalidParams))
+	})
+}
+
 /*
 Now hundreds of lines of testcases should follow, but let's be honest, nobody would read them all when reviewing
 a code challenge, so instead we can have some fun time and look at this elephant by Joan G. Stark:
@@ -7,6 +7,8 @@ import (
 
 	model "github.com/a-faceit-candidate/userservice/internal/model"
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // Service is an autogenerated mock type for the Service type
@@ -51,6 +53,57 @@ func (_m *Service) Delete(_a0 context.Context, _a1 string) error {
 	return r0
 }
 
+// DeleteVersioned provides a mock function with given fields: ctx, id, prevUpdatedAt
+func (_m *Service) DeleteVersioned(ctx context.Context, id string, prevUpdatedAt time.Time) error {
+	ret := _m.Called(ctx, id, prevUpdatedAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, prevUpdatedAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Erase provides a mock function with given fields: ctx, id
+func (_m *Service) Erase(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ExportCredentials provides a mock function with given fields: ctx, id
+func (_m *Service) ExportCredentials(ctx context.Context, id string) (*model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Get provides a mock function with given fields: _a0, _a1
 func (_m *Service) Get(_a0 context.Context, _a1 string) (*model.User, error) {
 	ret := _m.Called(_a0, _a1)
@@ -74,13 +127,89 @@ func (_m *Service) Get(_a0 context.Context, _a1 string) (*model.User, error) {
 	return r0, r1
 }
 
-// ListAll provides a mock function with given fields: _a0
-func (_m *Service) ListAll(_a0 context.Context) ([]*model.User, error) {
-	ret := _m.Called(_a0)
+// GetByEmail provides a mock function with given fields: ctx, email
+func (_m *Service) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	ret := _m.Called(ctx, email)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAll provides a mock function with given fields: ctx, includeDeleted
+func (_m *Service) ListAll(ctx context.Context, includeDeleted bool) ([]*model.User, error) {
+	ret := _m.Called(ctx, includeDeleted)
+
+	var r0 []*model.User
+	if rf, ok := ret.Get(0).(func(context.Context, bool) []*model.User); ok {
+		r0 = rf(ctx, includeDeleted)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, bool) error); ok {
+		r1 = rf(ctx, includeDeleted)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAllPage provides a mock function with given fields: ctx, cursor, limit, includeDeleted
+func (_m *Service) ListAllPage(ctx context.Context, cursor string, limit int, includeDeleted bool) ([]*model.User, string, error) {
+	ret := _m.Called(ctx, cursor, limit, includeDeleted)
+
+	var r0 []*model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, bool) []*model.User); ok {
+		r0 = rf(ctx, cursor, limit, includeDeleted)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	var r1 string
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, bool) string); ok {
+		r1 = rf(ctx, cursor, limit, includeDeleted)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, int, bool) error); ok {
+		r2 = rf(ctx, cursor, limit, includeDeleted)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ListCountry provides a mock function with given fields: ctx, countryCode, includeDeleted
+func (_m *Service) ListCountry(ctx context.Context, countryCode string, includeDeleted bool) ([]*model.User, error) {
+	ret := _m.Called(ctx, countryCode, includeDeleted)
 
 	var r0 []*model.User
-	if rf, ok := ret.Get(0).(func(context.Context) []*model.User); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) []*model.User); ok {
+		r0 = rf(ctx, countryCode, includeDeleted)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*model.User)
@@ -88,8 +217,8 @@ func (_m *Service) ListAll(_a0 context.Context) ([]*model.User, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool) error); ok {
+		r1 = rf(ctx, countryCode, includeDeleted)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -97,22 +226,75 @@ func (_m *Service) ListAll(_a0 context.Context) ([]*model.User, error) {
 	return r0, r1
 }
 
-// ListCountry provides a mock function with given fields: ctx, countryCode
-func (_m *Service) ListCountry(ctx context.Context, countryCode string) ([]*model.User, error) {
-	ret := _m.Called(ctx, countryCode)
+// ListCountryPage provides a mock function with given fields: ctx, countryCode, cursor, limit, includeDeleted
+func (_m *Service) ListCountryPage(ctx context.Context, countryCode string, cursor string, limit int, includeDeleted bool) ([]*model.User, string, error) {
+	ret := _m.Called(ctx, countryCode, cursor, limit, includeDeleted)
 
 	var r0 []*model.User
-	if rf, ok := ret.Get(0).(func(context.Context, string) []*model.User); ok {
-		r0 = rf(ctx, countryCode)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int, bool) []*model.User); ok {
+		r0 = rf(ctx, countryCode, cursor, limit, includeDeleted)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*model.User)
 		}
 	}
 
+	var r1 string
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int, bool) string); ok {
+		r1 = rf(ctx, countryCode, cursor, limit, includeDeleted)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, int, bool) error); ok {
+		r2 = rf(ctx, countryCode, cursor, limit, includeDeleted)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Patch provides a mock function with given fields: ctx, id, patch
+func (_m *Service) Patch(ctx context.Context, id string, patch *model.UserPatch) (*model.User, error) {
+	ret := _m.Called(ctx, id, patch)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.UserPatch) *model.User); ok {
+		r0 = rf(ctx, id, patch)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *model.UserPatch) error); ok {
+		r1 = rf(ctx, id, patch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Restore provides a mock function with given fields: ctx, id
+func (_m *Service) Restore(ctx context.Context, id string) (*model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, countryCode)
+		r1 = rf(ctx, id)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -120,13 +302,13 @@ func (_m *Service) ListCountry(ctx context.Context, countryCode string) ([]*mode
 	return r0, r1
 }
 
-// Update provides a mock function with given fields: _a0, _a1
-func (_m *Service) Update(_a0 context.Context, _a1 *model.User) (*model.User, error) {
-	ret := _m.Called(_a0, _a1)
+// Update provides a mock function with given fields: ctx, id, user
+func (_m *Service) Update(ctx context.Context, id string, user *model.User) (*model.User, error) {
+	ret := _m.Called(ctx, id, user)
 
 	var r0 *model.User
-	if rf, ok := ret.Get(0).(func(context.Context, *model.User) *model.User); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.User) *model.User); ok {
+		r0 = rf(ctx, id, user)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*model.User)
@@ -134,8 +316,50 @@ func (_m *Service) Update(_a0 context.Context, _a1 *model.User) (*model.User, er
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *model.User) error); ok {
-		r1 = rf(_a0, _a1)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *model.User) error); ok {
+		r1 = rf(ctx, id, user)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyPassword provides a mock function with given fields: ctx, id, password
+func (_m *Service) VerifyPassword(ctx context.Context, id string, password string) (bool, error) {
+	ret := _m.Called(ctx, id, password)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, id, password)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, id, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyPasswordByEmail provides a mock function with given fields: ctx, email, password
+func (_m *Service) VerifyPasswordByEmail(ctx context.Context, email string, password string) (bool, error) {
+	ret := _m.Called(ctx, email, password)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, email, password)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, email, password)
 	} else {
 		r1 = ret.Error(1)
 	}
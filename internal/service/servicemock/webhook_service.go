@@ -0,0 +1,144 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package servicemock
+
+import (
+	context "context"
+
+	model "github.com/a-faceit-candidate/userservice/internal/model"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// WebhookService is an autogenerated mock type for the WebhookService type
+type WebhookService struct {
+	mock.Mock
+}
+
+// CreateWebhook provides a mock function with given fields: ctx, webhook
+func (_m *WebhookService) CreateWebhook(ctx context.Context, webhook *model.Webhook) (*model.Webhook, error) {
+	ret := _m.Called(ctx, webhook)
+
+	var r0 *model.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Webhook) *model.Webhook); ok {
+		r0 = rf(ctx, webhook)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *model.Webhook) error); ok {
+		r1 = rf(ctx, webhook)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteWebhook provides a mock function with given fields: ctx, id
+func (_m *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EnableWebhook provides a mock function with given fields: ctx, id
+func (_m *WebhookService) EnableWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Webhook); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWebhook provides a mock function with given fields: ctx, id
+func (_m *WebhookService) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Webhook); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListWebhookDeliveries provides a mock function with given fields: ctx, id, limit
+func (_m *WebhookService) ListWebhookDeliveries(ctx context.Context, id string, limit int) ([]*model.WebhookDelivery, error) {
+	ret := _m.Called(ctx, id, limit)
+
+	var r0 []*model.WebhookDelivery
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []*model.WebhookDelivery); ok {
+		r0 = rf(ctx, id, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.WebhookDelivery)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, id, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListWebhooks provides a mock function with given fields: ctx
+func (_m *WebhookService) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []*model.Webhook
+	if rf, ok := ret.Get(0).(func(context.Context) []*model.Webhook); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Webhook)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
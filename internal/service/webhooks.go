@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/event"
+	"github.com/a-faceit-candidate/userservice/internal/log"
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+)
+
+// WebhookEvents are the topics of the events that can be delivered to the webhooks
+var WebhookEvents = []string{"user.created", "user.updated", "user.deleted"}
+
+// webhookSecretBytes is the length of the generated secrets, which are hex-encoded
+const webhookSecretBytes = 32
+
+// WebhookService manages the webhooks receiving the user lifecycle events
+type WebhookService interface {
+	// CreateWebhook fills the ID, CreatedAt and UpdatedAt fields of the webhook, and its Secret if it's not provided.
+	// Events should be some of the WebhookEvents, all of them are delivered if it's empty.
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) (*model.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	// EnableWebhook enables again a webhook that was disabled after failing too many times.
+	EnableWebhook(ctx context.Context, id string) (*model.Webhook, error)
+	// ListWebhookDeliveries retrieves up to limit deliveries of the webhook, newest first.
+	// A zero limit means DefaultPageLimit.
+	ListWebhookDeliveries(ctx context.Context, id string, limit int) ([]*model.WebhookDelivery, error)
+}
+
+//go:generate mockery -output servicemock -outpkg servicemock -case underscore -name WebhookService
+
+// WebhookRegistrations caches the registered webhooks, event.WebhookDispatcher implements it
+type WebhookRegistrations interface {
+	// Refresh reloads the registered webhooks
+	Refresh(ctx context.Context) error
+}
+
+//go:generate mockery -inpkg -testonly -case underscore -name WebhookRegistrations
+
+// NewWebhookService provides an implementation of WebhookService, which refreshes the registrations provided on every change.
+// Webhooks pointing to loopback, link-local or private addresses are rejected unless allowPrivateURLs is set.
+func NewWebhookService(repo persistence.WebhookRepository, registrations WebhookRegistrations, allowPrivateURLs bool) *WebhookServiceImpl {
+	return &WebhookServiceImpl{
+		repo:             repo,
+		registrations:    registrations,
+		allowPrivateURLs: allowPrivateURLs,
+	}
+}
+
+type WebhookServiceImpl struct {
+	repo             persistence.WebhookRepository
+	registrations    WebhookRegistrations
+	allowPrivateURLs bool
+}
+
+func (s *WebhookServiceImpl) CreateWebhook(ctx context.Context, webhook *model.Webhook) (*model.Webhook, error) {
+	if err := s.validateWebhook(webhook); err != nil {
+		return nil, err
+	}
+
+	if webhook.Secret == "" {
+		secret := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("can't generate secret: %w", err)
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	webhook.ID = uuidv1()
+	webhook.CreatedAt = timeNow().Truncate(time.Microsecond)
+	webhook.UpdatedAt = webhook.CreatedAt
+	webhook.ConsecutiveFailures = 0
+	webhook.DisabledAt = time.Time{}
+
+	if err := s.repo.CreateWebhook(ctx, webhook); err != nil {
+		if err == persistence.ErrConflict {
+			return nil, fmt.Errorf("internal error: we've generated a duplicated uuid")
+		}
+		return nil, err
+	}
+
+	log.For(ctx).Infof("Webhook %s was created for %s", webhook.ID, webhook.URL)
+	s.refresh(ctx)
+	return webhook, nil
+}
+
+func (s *WebhookServiceImpl) GetWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	webhook, err := s.repo.GetWebhook(ctx, id)
+	if err == persistence.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return webhook, err
+}
+
+func (s *WebhookServiceImpl) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	return s.repo.ListWebhooks(ctx)
+}
+
+func (s *WebhookServiceImpl) DeleteWebhook(ctx context.Context, id string) error {
+	if err := s.repo.DeleteWebhook(ctx, id); err != nil {
+		if err == persistence.ErrNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+	log.For(ctx).Infof("Webhook %s was deleted", id)
+	s.refresh(ctx)
+	return nil
+}
+
+func (s *WebhookServiceImpl) EnableWebhook(ctx context.Context, id string) (*model.Webhook, error) {
+	if err := s.repo.EnableWebhook(ctx, id, timeNow().Truncate(time.Microsecond)); err != nil {
+		if err == persistence.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	log.For(ctx).Infof("Webhook %s was enabled", id)
+	s.refresh(ctx)
+	return s.GetWebhook(ctx, id)
+}
+
+func (s *WebhookServiceImpl) ListWebhookDeliveries(ctx context.Context, id string, limit int) ([]*model.WebhookDelivery, error) {
+	if limit < 0 || limit > MaxPageLimit {
+		return nil, fmt.Errorf("%w: limit should be between 0 and %d", ErrInvalidParams, MaxPageLimit)
+	}
+	if limit == 0 {
+		limit = DefaultPageLimit
+	}
+	// deliveries are kept after the webhook is deleted, but they're not reachable through the deleted webhook
+	if _, err := s.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, id, limit)
+}
+
+// refresh doesn't fail, as the change is already stored, the registrations are refreshed periodically anyway
+func (s *WebhookServiceImpl) refresh(ctx context.Context) {
+	if err := s.registrations.Refresh(ctx); err != nil {
+		log.For(ctx).Warningf("Can't refresh webhooks: %s", err)
+	}
+}
+
+// validateWebhook only rejects the urls that are obviously private, the resolved addresses are checked when delivering
+func (s *WebhookServiceImpl) validateWebhook(webhook *model.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil {
+		return fmt.Errorf("%w: invalid url: %s", ErrInvalidParams, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url should be an absolute http or https url", ErrInvalidParams)
+	}
+	if !s.allowPrivateURLs && isPrivateHost(u.Hostname()) {
+		return fmt.Errorf("%w: url can't point to a loopback, link-local or private address", ErrInvalidParams)
+	}
+	if len(webhook.URL) > 2048 {
+		return fmt.Errorf("%w: url can't be longer than 2048 characters", ErrInvalidParams)
+	}
+	if len(webhook.Secret) > 255 {
+		return fmt.Errorf("%w: secret can't be longer than 255 characters", ErrInvalidParams)
+	}
+	for _, ev := range webhook.Events {
+		if !isWebhookEvent(ev) {
+			return fmt.Errorf("%w: unknown event %q, it should be one of %v", ErrInvalidParams, ev, WebhookEvents)
+		}
+	}
+	return nil
+}
+
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && event.IsPrivateAddress(ip)
+}
+
+func isWebhookEvent(topic string) bool {
+	for _, ev := range WebhookEvents {
+		if ev == topic {
+			return true
+		}
+	}
+	return false
+}
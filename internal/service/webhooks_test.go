@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a-faceit-candidate/userservice/internal/model"
+	"github.com/a-faceit-candidate/userservice/internal/persistence"
+	"github.com/a-faceit-candidate/userservice/internal/persistence/persistencemock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestWebhookServiceImpl_CreateWebhook(t *testing.T) {
+	t.Run("generates the secret", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("CreateWebhook", mock.Anything, mock.Anything).Return(nil).Once()
+		registrations := &MockWebhookRegistrations{}
+		registrations.On("Refresh", mock.Anything).Return(nil).Once()
+
+		created, err := NewWebhookService(repo, registrations, false).CreateWebhook(context.Background(), &model.Webhook{
+			URL:    "https://example.com/hook",
+			Events: []string{"user.created"},
+		})
+		assert.NoError(t, err)
+		registrations.AssertExpectations(t)
+		assert.Equal(t, mockedUUID, created.ID)
+		assert.Equal(t, mockedNow.Truncate(time.Microsecond), created.CreatedAt)
+		assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+		assert.Len(t, created.Secret, 2*webhookSecretBytes)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("keeps the secret provided", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("CreateWebhook", mock.Anything, mock.Anything).Return(nil).Once()
+		registrations := &MockWebhookRegistrations{}
+		registrations.On("Refresh", mock.Anything).Return(assert.AnError).Once()
+
+		// failing to refresh doesn't fail the creation
+		created, err := NewWebhookService(repo, registrations, false).CreateWebhook(context.Background(), &model.Webhook{
+			URL:    "http://example.com/hook",
+			Secret: "s3cr3t",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cr3t", created.Secret)
+	})
+
+	for name, webhook := range map[string]*model.Webhook{
+		"relative url":  {URL: "/hook"},
+		"not http url":  {URL: "ftp://example.com/hook"},
+		"unknown event": {URL: "https://example.com/hook", Events: []string{"user.snapshot"}},
+		"malformed url": {URL: "https://example.com/%zz"},
+		"joined events": {URL: "https://example.com/hook", Events: []string{"user.created,user.updated"}},
+		"localhost url": {URL: "http://localhost:8080/hook"},
+		"loopback url":  {URL: "http://127.0.0.1/hook"},
+		"private url":   {URL: "https://10.0.0.1/hook"},
+		"metadata url":  {URL: "http://169.254.169.254/latest/meta-data"},
+		"ipv6 url":      {URL: "http://[::1]/hook"},
+		"cgnat url":     {URL: "https://100.64.0.1/hook"},
+		"mapped url":    {URL: "http://[::ffff:169.254.169.254]/latest/meta-data"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewWebhookService(&persistencemock.WebhookRepository{}, &MockWebhookRegistrations{}, false).CreateWebhook(context.Background(), webhook)
+			assert.True(t, errors.Is(err, ErrInvalidParams))
+		})
+	}
+
+	t.Run("private urls can be allowed", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("CreateWebhook", mock.Anything, mock.Anything).Return(nil).Once()
+		registrations := &MockWebhookRegistrations{}
+		registrations.On("Refresh", mock.Anything).Return(nil).Once()
+
+		_, err := NewWebhookService(repo, registrations, true).CreateWebhook(context.Background(), &model.Webhook{URL: "http://localhost:8080/hook"})
+		assert.NoError(t, err)
+	})
+}
+
+func TestWebhookServiceImpl_DeleteWebhook(t *testing.T) {
+	t.Run("refreshes the registrations", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("DeleteWebhook", mock.Anything, "some-id").Return(nil).Once()
+		registrations := &MockWebhookRegistrations{}
+		registrations.On("Refresh", mock.Anything).Return(nil).Once()
+
+		assert.NoError(t, NewWebhookService(repo, registrations, false).DeleteWebhook(context.Background(), "some-id"))
+		registrations.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("DeleteWebhook", mock.Anything, "some-id").Return(persistence.ErrNotFound).Once()
+
+		assert.Equal(t, ErrNotFound, NewWebhookService(repo, &MockWebhookRegistrations{}, false).DeleteWebhook(context.Background(), "some-id"))
+	})
+}
+
+func TestWebhookServiceImpl_ListWebhookDeliveries(t *testing.T) {
+	t.Run("webhook not found", func(t *testing.T) {
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("GetWebhook", mock.Anything, "some-id").Return(nil, persistence.ErrNotFound).Once()
+
+		_, err := NewWebhookService(repo, &MockWebhookRegistrations{}, false).ListWebhookDeliveries(context.Background(), "some-id", 0)
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("default limit", func(t *testing.T) {
+		deliveries := []*model.WebhookDelivery{{ID: 1, WebhookID: "some-id"}}
+		repo := &persistencemock.WebhookRepository{}
+		repo.On("GetWebhook", mock.Anything, "some-id").Return(&model.Webhook{ID: "some-id"}, nil).Once()
+		repo.On("ListDeliveries", mock.Anything, "some-id", DefaultPageLimit).Return(deliveries, nil).Once()
+
+		got, err := NewWebhookService(repo, &MockWebhookRegistrations{}, false).ListWebhookDeliveries(context.Background(), "some-id", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, deliveries, got)
+		repo.AssertExpectations(t)
+	})
+}
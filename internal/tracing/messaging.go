@@ -0,0 +1,24 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartPublishSpan starts the span of publishing the payload to the NSQ topic, as a child of the span in ctx.
+// Every path publishing events should use it, so their spans have the same name and attributes,
+// extra attributes can be added to describe where the event comes from.
+func StartPublishSpan(ctx context.Context, topic string, payload []byte, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "nsq"),
+			attribute.String("messaging.destination", topic),
+			attribute.Int("messaging.message_payload_size_bytes", len(payload)),
+		),
+		trace.WithAttributes(attrs...),
+	)
+}
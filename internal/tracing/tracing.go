@@ -0,0 +1,80 @@
+// Package tracing configures the OpenTelemetry tracing of the service
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter defines where the spans are exported
+type Exporter string
+
+const (
+	// ExporterNone doesn't export the spans, although the trace context received is still propagated
+	ExporterNone Exporter = "none"
+	// ExporterOTLP exports the spans to an OTLP gRPC endpoint, like the OpenTelemetry collector
+	ExporterOTLP Exporter = "otlp"
+	// ExporterStdout writes the spans to the standard output, it's intended for local runs
+	ExporterStdout Exporter = "stdout"
+)
+
+// Config configures the tracing
+type Config struct {
+	// Exporter is "none", "otlp" or "stdout"
+	Exporter Exporter `default:"none"`
+	// OTLPEndpoint is the host:port of the OTLP gRPC endpoint
+	OTLPEndpoint string `default:"otel-collector:4317"`
+	// OTLPInsecure disables TLS, as the collector is usually running next to the service
+	OTLPInsecure bool `default:"true"`
+	// SampleRatio is the ratio of the traces sampled, unless the caller has already decided whether to sample them
+	SampleRatio float64 `default:"1"`
+	// ServiceName is the service.name of the spans
+	ServiceName string `default:"userservice"`
+}
+
+// Setup sets the global tracer provider and the W3C trace context propagator.
+// The func returned flushes the pending spans and stops the exporter, it should be called once the service is stopped.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint)}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		var err error
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("can't create OTLP exporter: %w", err)
+		}
+	case ExporterStdout:
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("can't create stdout exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes("", attribute.String("service.name", cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,11 @@
+CREATE TABLE outbox (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `created_at` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    `topic` VARCHAR(255) NOT NULL,
+    `payload` MEDIUMBLOB NOT NULL,
+    `attempts` INT UNSIGNED NOT NULL DEFAULT 0,
+    `delivered_at` DATETIME(6) NULL,
+
+    INDEX `by_delivered_at` (`delivered_at`, `id`),
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
@@ -2,14 +2,19 @@ CREATE TABLE user (
     `id` CHAR(36) NOT NULL,
     `created_at` DATETIME(6) NOT NULL,
     `updated_at` DATETIME(6) NOT NULL,
+    `version` BIGINT UNSIGNED NOT NULL DEFAULT 1,
     `first_name` VARCHAR(255) NOT NULL,
     `last_name` VARCHAR(255) NOT NULL,
     `name` VARCHAR(255) NOT NULL,
     `email` VARCHAR(255) NOT NULL,
+    `normalized_email` VARCHAR(255) NOT NULL,
     `password_hash` VARCHAR(255) NOT NULL,
     `password_salt` VARCHAR(255) NOT NULL,
     `country` CHAR(2) NOT NULL,
+    `deleted_at` DATETIME(6) NULL,
 
     INDEX `by_country` (`country`, `id`),
+    UNIQUE INDEX `by_normalized_email` (`normalized_email`),
+    INDEX `by_deleted_at` (`deleted_at`),
     PRIMARY KEY (`id`)
 ) ENGINE=InnoDB;
\ No newline at end of file
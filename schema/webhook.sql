@@ -0,0 +1,28 @@
+CREATE TABLE webhook (
+    `id` CHAR(36) NOT NULL,
+    `created_at` DATETIME(6) NOT NULL,
+    `updated_at` DATETIME(6) NOT NULL,
+    `url` VARCHAR(2048) NOT NULL,
+    `secret` VARCHAR(255) NOT NULL,
+    `events` VARCHAR(255) NOT NULL,
+    `consecutive_failures` INT UNSIGNED NOT NULL DEFAULT 0,
+    `disabled_at` DATETIME(6) NULL,
+
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB;
+
+CREATE TABLE webhook_delivery (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `webhook_id` CHAR(36) NOT NULL,
+    `created_at` DATETIME(6) NOT NULL,
+    `delivery_id` CHAR(36) NOT NULL,
+    `topic` VARCHAR(255) NOT NULL,
+    `attempt` INT UNSIGNED NOT NULL,
+    `status_code` INT NOT NULL,
+    `error` VARCHAR(1024) NOT NULL,
+    `duration_us` BIGINT UNSIGNED NOT NULL,
+
+    INDEX `by_webhook_id` (`webhook_id`, `id`),
+    INDEX `by_created_at` (`created_at`),
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB;